@@ -0,0 +1,146 @@
+// Package commands contains the commands of the command-line client of the service.
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/illyasch/url-shortener/pkg/client"
+)
+
+// ErrHelp provides context that help was given.
+var ErrHelp = errors.New("provided help")
+
+// The output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatPlain = "plain"
+)
+
+// Env is what the commands run with.
+type Env struct {
+	Client *client.Client
+
+	// Domain is the branded domain the links are managed in, the domain of the server's host when empty.
+	Domain string
+
+	// Format is the format of the output: FormatTable, FormatJSON or FormatPlain.
+	Format string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// output writes the results of a command to the standard output in the format: the value as JSON,
+// the rows under the header as a table or the plain lines, which are easy to pipe to other programs.
+func (env Env) output(v any, header []string, rows [][]string, plain []string) error {
+	switch env.Format {
+	case FormatJSON:
+		enc := json.NewEncoder(env.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case FormatPlain:
+		for _, line := range plain {
+			if _, err := fmt.Fprintln(env.Stdout, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// failed writes the error of an input of a bulk command to the standard error.
+func (env Env) failed(input string, err error) {
+	fmt.Fprintf(env.Stderr, "%s: %v\n", input, err)
+}
+
+// inputs returns the arguments or, when there are none or the only one is -, the lines of the
+// standard input. The empty lines and the lines starting with # are skipped.
+func (env Env) inputs(args []string) ([]string, error) {
+	if len(args) > 0 && !(len(args) == 1 && args[0] == "-") {
+		return args, nil
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(env.Stdin)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+
+	return lines, nil
+}
+
+// bulkError returns the error of a bulk command some inputs of which failed.
+func bulkError(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of %d failed", failed, total)
+}
+
+// parseFlags parses the flags of the command which can be mixed with its arguments,
+// e.g. qr udXWFB -o qr.png, and returns the arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, ErrHelp
+			}
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// newFlagSet constructs the flag set of the command which prints its usage to the standard error.
+func (env Env) newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "usage: shortener %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// stringsFlag is a flag which can be repeated, e.g. --tag a --tag b.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,167 @@
+package commands_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/illyasch/url-shortener/cmd/shortener/commands"
+	"github.com/illyasch/url-shortener/cmd/url-shortener/handlers"
+	"github.com/illyasch/url-shortener/pkg/client"
+	"github.com/illyasch/url-shortener/pkg/data/database/dbtest"
+	"github.com/illyasch/url-shortener/pkg/sys/logger"
+)
+
+var (
+	postgresDB *sqlx.DB
+	stdLgr     *zap.SugaredLogger
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	stdLgr, err = logger.New("shortener")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	postgresDB, err = dbtest.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// apiKey is the API key the served router lets the changes of the links through with.
+const apiKey = "test-api-key"
+
+// command is a command running against the service with the standard input.
+type command func(ctx context.Context, env commands.Env, args []string) error
+
+// runner returns the function running the commands against the served router in the format
+// and returning their standard output and standard error.
+func runner(t *testing.T, format string) func(cmd command, stdin string, args ...string) (string, string, error) {
+	t.Helper()
+
+	srv := httptest.NewServer(handlers.APIConfig{Log: stdLgr, DB: postgresDB, APIKeys: []string{apiKey}}.Router())
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(client.Config{BaseURL: srv.URL, APIKey: apiKey, MaxRetries: -1})
+	require.NoError(t, err)
+
+	return func(cmd command, stdin string, args ...string) (string, string, error) {
+		var stdout, stderr bytes.Buffer
+		env := commands.Env{
+			Client: c,
+			Format: format,
+			Stdin:  strings.NewReader(stdin),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		}
+
+		err := cmd(context.Background(), env, args)
+		return stdout.String(), stderr.String(), err
+	}
+}
+
+func TestShorten_bulkErrors(t *testing.T) {
+	t.Parallel()
+	run := runner(t, commands.FormatJSON)
+
+	stdout, stderr, err := run(commands.Shorten, "# not shortened\n\nhjef\n")
+	assert.EqualError(t, err, "1 of 1 failed")
+	assert.JSONEq(t, "[]", stdout)
+	assert.True(t, strings.HasPrefix(stderr, "hjef: "), stderr)
+
+	_, _, err = run(commands.Shorten, "", "--not-after", "tomorrow", "https://www.testurl.com")
+	assert.Error(t, err)
+
+	_, _, err = run(commands.QR, "", "-o", "qr.png")
+	assert.ErrorIs(t, err, commands.ErrHelp)
+}
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+	run := runner(t, commands.FormatPlain)
+
+	owner := uuid.NewString()
+	urls := []string{
+		"https://www.testurl.com/cli/" + uuid.NewString(),
+		"https://www.testurl.com/cli/" + uuid.NewString(),
+	}
+
+	stdout, stderr, err := run(commands.Shorten, strings.Join(urls, "\n"), "-owner", owner, "-tag", "cli", "-")
+	require.NoError(t, err, stderr)
+	shortURLs := strings.Fields(stdout)
+	require.Len(t, shortURLs, 2)
+
+	codes := make([]string, len(shortURLs))
+	for i, u := range shortURLs {
+		codes[i] = u[strings.LastIndex(u, "/")+1:]
+	}
+
+	t.Run("expand", func(t *testing.T) {
+		stdout, _, err := run(commands.Expand, "", codes...)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Join(urls, "\n")+"\n", stdout)
+	})
+
+	t.Run("ls", func(t *testing.T) {
+		stdout, stderr, err := runner(t, commands.FormatJSON)(commands.List, "", "--owner", owner, "--limit", "1", "--all")
+		require.NoError(t, err)
+		assert.Empty(t, stderr)
+
+		var links []client.Link
+		require.NoError(t, json.Unmarshal([]byte(stdout), &links))
+		require.Len(t, links, 2)
+		assert.Equal(t, urls[1], links[0].URL)
+		assert.Equal(t, []string{"cli"}, links[0].Tags)
+
+		_, stderr, err = run(commands.List, "", "--owner", owner, "--limit", "1")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(stderr, "more links: --cursor "), stderr)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		stdout, _, err := runner(t, commands.FormatTable)(commands.Stats, "", codes[0])
+		require.NoError(t, err)
+		assert.Contains(t, stdout, "CLICKS")
+		assert.Contains(t, stdout, shortURLs[0])
+	})
+
+	t.Run("qr", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "qr.svg")
+		_, _, err := run(commands.QR, "", codes[0], "-o", file, "--size", "128")
+		require.NoError(t, err)
+
+		img, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(img), "<svg")
+
+		stdout, _, err := run(commands.QR, "", codes[0])
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(stdout, "\x89PNG"))
+	})
+
+	t.Run("rm", func(t *testing.T) {
+		stdout, stderr, err := run(commands.Remove, codes[0]+"\n"+uuid.NewString()[:8]+"\n")
+		assert.EqualError(t, err, "1 of 2 failed")
+		assert.Equal(t, codes[0]+"\n", stdout)
+		assert.NotEmpty(t, stderr)
+
+		_, _, err = run(commands.Expand, "", codes[0])
+		assert.Error(t, err)
+	})
+}
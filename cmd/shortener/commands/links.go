@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/illyasch/url-shortener/pkg/client"
+)
+
+// Shorten shortens the URLs of the arguments or of the standard input, a URL a line.
+// The many URLs are shortened in batches.
+func Shorten(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("shorten", "shorten [flags] [url...]")
+	var nl client.NewLink
+	var tags stringsFlag
+	var notAfter string
+	fs.StringVar(&nl.Owner, "owner", "", "owner of the links")
+	fs.Var(&tags, "tag", "tag of the links, can be repeated")
+	fs.StringVar(&nl.Password, "password", "", "password protecting the links")
+	fs.Int64Var(&nl.MaxClicks, "max-clicks", 0, "number of times the links can be opened")
+	fs.StringVar(&notAfter, "not-after", "", "RFC 3339 time the links expire at")
+	fs.BoolVar(&nl.Passthrough, "passthrough", false, "pass the extra path and query of the short URLs through")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if notAfter != "" {
+		t, err := time.Parse(time.RFC3339, notAfter)
+		if err != nil {
+			return fmt.Errorf("not-after must be an RFC 3339 time: %w", err)
+		}
+		nl.NotAfter = &t
+	}
+	nl.Tags = tags
+	nl.Domain = env.Domain
+
+	urls, err := env.inputs(args)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		URL string `json:"url"`
+		client.ShortURL
+	}
+	var (
+		results = []result{}
+		failed  int
+	)
+	for len(urls) > 0 {
+		n := len(urls)
+		if n > client.MaxBatch {
+			n = client.MaxBatch
+		}
+
+		links := make([]client.NewLink, n)
+		for i, u := range urls[:n] {
+			links[i] = nl
+			links[i].URL = u
+		}
+
+		batch, err := env.Client.ShortenBatch(ctx, links)
+		if err != nil {
+			return fmt.Errorf("shorten: %w", err)
+		}
+		for i, r := range batch {
+			if r.Err != nil {
+				env.failed(urls[i], r.Err)
+				failed++
+				continue
+			}
+			results = append(results, result{URL: urls[i], ShortURL: r.ShortURL})
+		}
+
+		urls = urls[n:]
+	}
+
+	rows := make([][]string, len(results))
+	plain := make([]string, len(results))
+	for i, r := range results {
+		rows[i] = []string{r.Code, r.ShortURL.ShortURL, r.URL}
+		plain[i] = r.ShortURL.ShortURL
+	}
+	if err := env.output(results, []string{"CODE", "SHORT URL", "URL"}, rows, plain); err != nil {
+		return err
+	}
+
+	return bulkError(failed, failed+len(results))
+}
+
+// Expand opens the links with the codes of the arguments or of the standard input and
+// shows their destinations. Every expansion counts a click.
+func Expand(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("expand", "expand [flags] [code...]")
+	var v client.Visit
+	fs.StringVar(&v.Password, "password", "", "password of the protected links")
+	fs.StringVar(&v.Path, "path", "", "path passed through to the destinations")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	codes, err := env.inputs(args)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		Code string `json:"code"`
+		client.Expansion
+	}
+	var (
+		results = []result{}
+		failed  int
+	)
+	for _, code := range codes {
+		exp, err := env.Client.Expand(ctx, code, v)
+		if err != nil {
+			env.failed(code, err)
+			failed++
+			continue
+		}
+		results = append(results, result{Code: code, Expansion: exp})
+	}
+
+	rows := make([][]string, len(results))
+	plain := make([]string, len(results))
+	for i, r := range results {
+		rows[i] = []string{r.Code, r.URL}
+		plain[i] = r.URL
+	}
+	if err := env.output(results, []string{"CODE", "URL"}, rows, plain); err != nil {
+		return err
+	}
+
+	return bulkError(failed, len(codes))
+}
+
+// List lists the links page by page. The cursor of the next page is written to the
+// standard error unless all the pages are listed.
+func List(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("ls", "ls [flags]")
+	var (
+		f   client.Filter
+		all bool
+	)
+	fs.StringVar(&f.Owner, "owner", "", "owner of the links")
+	fs.StringVar(&f.Tag, "tag", "", "tag of the links")
+	fs.StringVar(&f.Host, "host", "", "domain of the destinations")
+	fs.StringVar(&f.Query, "q", "", "substring of the destination URLs")
+	fs.IntVar(&f.Limit, "limit", 20, "number of the links on a page, up to 100")
+	fs.StringVar(&f.Cursor, "cursor", "", "cursor of the page")
+	fs.BoolVar(&all, "all", false, "list all the pages")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		fs.Usage()
+		return ErrHelp
+	}
+	f.Domain = env.Domain
+
+	links := []client.Link{}
+	for {
+		page, err := env.Client.Links(ctx, f)
+		if err != nil {
+			return fmt.Errorf("list: %w", err)
+		}
+		links = append(links, page.Links...)
+
+		if page.NextCursor == "" {
+			break
+		}
+		if !all {
+			fmt.Fprintf(env.Stderr, "more links: --cursor %s\n", page.NextCursor)
+			break
+		}
+		f.Cursor = page.NextCursor
+	}
+
+	rows := make([][]string, len(links))
+	plain := make([]string, len(links))
+	for i, l := range links {
+		rows[i] = []string{l.Code, l.ShortURL, strconv.FormatInt(l.Clicks, 10), l.DateCreated.Format(time.RFC3339), l.URL}
+		plain[i] = l.ShortURL
+	}
+
+	return env.output(links, []string{"CODE", "SHORT URL", "CLICKS", "CREATED", "URL"}, rows, plain)
+}
+
+// Remove deletes the links with the codes of the arguments or of the standard input.
+func Remove(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("rm", "rm [code...]")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	codes, err := env.inputs(args)
+	if err != nil {
+		return err
+	}
+
+	removed := []string{}
+	for _, code := range codes {
+		if err := env.Client.DeleteLink(ctx, env.Domain, code); err != nil {
+			env.failed(code, err)
+			continue
+		}
+		removed = append(removed, code)
+	}
+
+	rows := make([][]string, len(removed))
+	for i, code := range removed {
+		rows[i] = []string{code, "deleted"}
+	}
+	if err := env.output(removed, []string{"CODE", "STATUS"}, rows, removed); err != nil {
+		return err
+	}
+
+	return bulkError(len(codes)-len(removed), len(codes))
+}
+
+// Stats shows the clicks of the links with the codes of the arguments or of the standard input.
+func Stats(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("stats", "stats [code...]")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	codes, err := env.inputs(args)
+	if err != nil {
+		return err
+	}
+
+	results := []client.Stats{}
+	for _, code := range codes {
+		s, err := env.Client.Stats(ctx, env.Domain, code)
+		if err != nil {
+			env.failed(code, err)
+			continue
+		}
+		results = append(results, s)
+	}
+
+	rows := make([][]string, len(results))
+	plain := make([]string, len(results))
+	for i, s := range results {
+		variants := make([]string, len(s.Variants))
+		for j, v := range s.Variants {
+			variants[j] = v.Variant + "=" + strconv.FormatInt(v.Clicks, 10)
+		}
+
+		rows[i] = []string{s.Code, s.ShortURL, strconv.FormatInt(s.Clicks, 10), strings.Join(variants, " ")}
+		plain[i] = strconv.FormatInt(s.Clicks, 10)
+	}
+	if err := env.output(results, []string{"CODE", "SHORT URL", "CLICKS", "VARIANTS"}, rows, plain); err != nil {
+		return err
+	}
+
+	return bulkError(len(codes)-len(results), len(codes))
+}
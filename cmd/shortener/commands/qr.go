@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/illyasch/url-shortener/pkg/client"
+)
+
+// QR writes the image of the QR code of the link to the output file or the standard output.
+// The format is svg for the files with the .svg extension and png otherwise unless it is set.
+func QR(ctx context.Context, env Env, args []string) error {
+	fs := env.newFlagSet("qr", "qr [flags] code")
+	var (
+		o      client.QROptions
+		output string
+		margin int
+	)
+	fs.StringVar(&output, "o", "", "output file, the standard output when empty or -")
+	fs.StringVar(&o.Format, "format", "", "png or svg")
+	fs.IntVar(&o.Size, "size", 0, "side of the image in pixels")
+	fs.StringVar(&o.ECC, "ecc", "", "error correction level: L, M, Q or H")
+	fs.IntVar(&margin, "margin", 4, "quiet zone in modules")
+	fs.StringVar(&o.FG, "fg", "", "foreground colour in RRGGBB or RRGGBBAA hex notation")
+	fs.StringVar(&o.BG, "bg", "", "background colour in RRGGBB or RRGGBBAA hex notation")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return ErrHelp
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "margin" {
+			o.Margin = &margin
+		}
+	})
+	if o.Format == "" && strings.EqualFold(filepath.Ext(output), ".svg") {
+		o.Format = "svg"
+	}
+
+	img, err := env.Client.QRCode(ctx, args[0], o)
+	if err != nil {
+		return fmt.Errorf("qr: %w", err)
+	}
+
+	if output == "" || output == "-" {
+		_, err := env.Stdout.Write(img)
+		return err
+	}
+	if err := os.WriteFile(output, img, 0o644); err != nil {
+		return fmt.Errorf("write qr: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+// This program is the command-line client of the url-shortener service.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/ardanlabs/conf/v3"
+	"github.com/ardanlabs/conf/v3/yaml"
+
+	"github.com/illyasch/url-shortener/cmd/shortener/commands"
+	"github.com/illyasch/url-shortener/pkg/client"
+)
+
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
+
+func main() {
+	if err := run(); err != nil {
+		if !errors.Is(err, commands.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "shortener:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	// Configuration
+	cfg := struct {
+		conf.Version
+		Args    conf.Args
+		Server  string        `conf:"default:http://localhost:3000,help:base URL of the service with its path prefix" yaml:"server"`
+		APIKey  string        `conf:"mask,help:API key sent as the bearer token of the requests" yaml:"api_key"`
+		Domain  string        `conf:"help:branded domain the links are managed in; the domain of the server when empty" yaml:"domain"`
+		Format  string        `conf:"default:table,short:f,help:format of the output: table | json | plain" yaml:"format"`
+		Timeout time.Duration `conf:"default:30s,help:time the command has to finish in" yaml:"timeout"`
+	}{
+		Version: conf.Version{
+			Build: build,
+			Desc:  "command-line client of the url-shortener service",
+		},
+	}
+
+	data, err := configFile()
+	if err != nil {
+		return err
+	}
+	var parsers []conf.Parsers
+	if data != nil {
+		parsers = append(parsers, yaml.WithData(data))
+	}
+
+	const prefix = "SHORTENER"
+	help, err := conf.Parse(prefix, &cfg, parsers...)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	switch cfg.Format {
+	case commands.FormatTable, commands.FormatJSON, commands.FormatPlain:
+	default:
+		return fmt.Errorf("format %q must be table, json or plain", cfg.Format)
+	}
+
+	c, err := client.New(client.Config{BaseURL: cfg.Server, APIKey: cfg.APIKey})
+	if err != nil {
+		return fmt.Errorf("constructing client: %w", err)
+	}
+
+	// Commands
+	env := commands.Env{
+		Client: c,
+		Domain: cfg.Domain,
+		Format: cfg.Format,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	return processCommands(ctx, cfg.Args, env)
+}
+
+// configFile reads the YAML config file SHORTENER_CONFIG or shortener/config.yaml in the user's
+// config directory. The missing default file is no config.
+func configFile() ([]byte, error) {
+	path := os.Getenv("SHORTENER_CONFIG")
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "shortener", "config.yaml"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return data, nil
+}
+
+// processCommands handles the execution of the commands specified on
+// the command line.
+func processCommands(ctx context.Context, args conf.Args, env commands.Env) error {
+	var rest []string
+	if len(args) > 1 {
+		rest = args[1:]
+	}
+
+	switch args.Num(0) {
+	case "shorten":
+		return commands.Shorten(ctx, env, rest)
+
+	case "expand":
+		return commands.Expand(ctx, env, rest)
+
+	case "ls":
+		return commands.List(ctx, env, rest)
+
+	case "rm":
+		return commands.Remove(ctx, env, rest)
+
+	case "stats":
+		return commands.Stats(ctx, env, rest)
+
+	case "qr":
+		return commands.QR(ctx, env, rest)
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: shortener [flags] command [command flags] [args]")
+		fmt.Fprintln(os.Stderr, "shorten: shorten the URLs of the arguments or of the standard input")
+		fmt.Fprintln(os.Stderr, "expand: show the destinations of the codes, counting a click")
+		fmt.Fprintln(os.Stderr, "ls: list the links")
+		fmt.Fprintln(os.Stderr, "rm: delete the links")
+		fmt.Fprintln(os.Stderr, "stats: show the clicks of the links")
+		fmt.Fprintln(os.Stderr, "qr: write the QR code image of a link, e.g. qr code -o qr.png")
+		fmt.Fprintln(os.Stderr, "run shortener --help for the flags and a command with -h for its flags.")
+		return commands.ErrHelp
+	}
+}
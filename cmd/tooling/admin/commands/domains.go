@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+	"github.com/illyasch/url-shortener/pkg/data/database"
+)
+
+// Domains prints the domains with their policies.
+func Domains(cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	domains, err := shortener.New(db).Domains(ctx)
+	if err != nil {
+		return fmt.Errorf("list domains: %w", err)
+	}
+
+	for _, d := range domains {
+		allowed := strings.Join(d.AllowedDomains, ",")
+		if allowed == "" {
+			allowed = "*"
+		}
+		interstitial := "off"
+		if d.Interstitial.Enabled {
+			interstitial = fmt.Sprintf("%ds, trusted %s", d.Interstitial.Delay, strings.Join(d.Interstitial.Trusted, ","))
+		}
+		fmt.Printf("%s\tallowed: %s\tfallback: %s\tutm: %s,%s,%s\tinterstitial: %s\n", d.Name, allowed, d.FallbackURL,
+			d.UTM.Source, d.UTM.Medium, d.UTM.Campaign, interstitial)
+	}
+	return nil
+}
+
+// DomainSave creates a domain or updates its policy. The allowed domains are
+// comma separated, an empty list allows any destination.
+func DomainSave(cfg database.Config, name string, allowed string, fallbackURL string) error {
+	const help = "help: domain-save <name> [allowed,domains] [fallback url]"
+
+	if name == "" {
+		fmt.Println(help)
+		return ErrHelp
+	}
+
+	d := shortener.Domain{
+		Name:        name,
+		FallbackURL: fallbackURL,
+	}
+	if err := d.Validate(); err != nil {
+		fmt.Println(help)
+		return err
+	}
+	for _, a := range strings.Split(allowed, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			d.AllowedDomains = append(d.AllowedDomains, a)
+		}
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := shortener.New(db).SaveDomain(ctx, d); err != nil {
+		return fmt.Errorf("save domain: %w", err)
+	}
+
+	fmt.Println("domain saved")
+	return nil
+}
+
+// DomainUTM sets the default UTM parameters of the domain's links. The empty
+// parameters are not added to the destinations.
+func DomainUTM(cfg database.Config, name string, source string, medium string, campaign string) error {
+	if name == "" {
+		fmt.Println("help: domain-utm <name> [utm_source] [utm_medium] [utm_campaign]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	u := shortener.UTM{Source: source, Medium: medium, Campaign: campaign}
+	if err := shortener.New(db).SetDomainUTM(ctx, name, u); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("domain %s does not exist", name)
+		}
+		return fmt.Errorf("set domain utm: %w", err)
+	}
+
+	fmt.Println("domain utm saved")
+	return nil
+}
+
+// DomainInterstitial turns the interstitial page of the domain's links on or off. The delay
+// of the continue button is in seconds and the trusted domains are comma separated.
+func DomainInterstitial(cfg database.Config, name string, mode string, delay string, trusted string) error {
+	if name == "" || (mode != "on" && mode != "off") {
+		fmt.Println("help: domain-interstitial <name> <on|off> [delay seconds] [trusted,domains]")
+		return ErrHelp
+	}
+
+	i := shortener.Interstitial{Enabled: mode == "on"}
+	if delay != "" {
+		var err error
+		if i.Delay, err = strconv.Atoi(delay); err != nil {
+			return fmt.Errorf("delay %s is not a number of seconds", delay)
+		}
+	}
+	for _, t := range strings.Split(trusted, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			i.Trusted = append(i.Trusted, t)
+		}
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := shortener.New(db).SetDomainInterstitial(ctx, name, i); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("domain %s does not exist", name)
+		}
+		return fmt.Errorf("set domain interstitial: %w", err)
+	}
+
+	fmt.Println("domain interstitial saved")
+	return nil
+}
+
+// DomainDelete deletes a domain which has no links.
+func DomainDelete(cfg database.Config, name string) error {
+	if name == "" {
+		fmt.Println("help: domain-delete <name>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := shortener.New(db).DeleteDomain(ctx, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("domain %s does not exist", name)
+		}
+		return fmt.Errorf("delete domain: %w", err)
+	}
+
+	fmt.Println("domain deleted")
+	return nil
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+	"github.com/illyasch/url-shortener/pkg/data/database"
+)
+
+// LinkDisable disables or enables the link with the code in the domain.
+// The default domain is used when the domain is empty.
+func LinkDisable(cfg database.Config, code string, domain string, disabled bool) error {
+	if code == "" {
+		fmt.Println("help: link-disable|link-enable <code> [domain]")
+		return ErrHelp
+	}
+	if domain == "" {
+		domain = shortener.DefaultDomain
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := shortener.New(db)
+	d, err := store.Domain(ctx, domain)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("domain %s does not exist", domain)
+		}
+		return fmt.Errorf("find domain: %w", err)
+	}
+
+	if err := store.SetDisabled(ctx, d, code, disabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("link %s does not exist in domain %s", code, domain)
+		}
+		return fmt.Errorf("change link: %w", err)
+	}
+
+	if disabled {
+		fmt.Println("link disabled")
+	} else {
+		fmt.Println("link enabled")
+	}
+	return nil
+}
+
+// LinkFlag flags the link with the code in the domain as unsafe or clears the flag.
+// The default domain is used when the domain is empty.
+func LinkFlag(cfg database.Config, code string, domain string, flagged bool) error {
+	if code == "" {
+		fmt.Println("help: link-flag|link-unflag <code> [domain]")
+		return ErrHelp
+	}
+	if domain == "" {
+		domain = shortener.DefaultDomain
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := shortener.New(db)
+	d, err := store.Domain(ctx, domain)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("domain %s does not exist", domain)
+		}
+		return fmt.Errorf("find domain: %w", err)
+	}
+
+	if err := store.SetFlagged(ctx, d, code, flagged); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("link %s does not exist in domain %s", code, domain)
+		}
+		return fmt.Errorf("change link: %w", err)
+	}
+
+	if flagged {
+		fmt.Println("link flagged")
+	} else {
+		fmt.Println("link unflagged")
+	}
+	return nil
+}
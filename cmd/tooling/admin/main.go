@@ -96,9 +96,53 @@ func processCommands(args conf.Args, log *zap.SugaredLogger, dbConfig database.C
 			return fmt.Errorf("seeding database: %w", err)
 		}
 
+	case "domains":
+		if err := commands.Domains(dbConfig); err != nil {
+			return fmt.Errorf("listing domains: %w", err)
+		}
+
+	case "domain-save":
+		if err := commands.DomainSave(dbConfig, args.Num(1), args.Num(2), args.Num(3)); err != nil {
+			return fmt.Errorf("saving domain: %w", err)
+		}
+
+	case "domain-utm":
+		if err := commands.DomainUTM(dbConfig, args.Num(1), args.Num(2), args.Num(3), args.Num(4)); err != nil {
+			return fmt.Errorf("saving domain utm: %w", err)
+		}
+
+	case "domain-interstitial":
+		if err := commands.DomainInterstitial(dbConfig, args.Num(1), args.Num(2), args.Num(3), args.Num(4)); err != nil {
+			return fmt.Errorf("saving domain interstitial: %w", err)
+		}
+
+	case "domain-delete":
+		if err := commands.DomainDelete(dbConfig, args.Num(1)); err != nil {
+			return fmt.Errorf("deleting domain: %w", err)
+		}
+
+	case "link-disable", "link-enable":
+		if err := commands.LinkDisable(dbConfig, args.Num(1), args.Num(2), args.Num(0) == "link-disable"); err != nil {
+			return fmt.Errorf("changing link: %w", err)
+		}
+
+	case "link-flag", "link-unflag":
+		if err := commands.LinkFlag(dbConfig, args.Num(1), args.Num(2), args.Num(0) == "link-flag"); err != nil {
+			return fmt.Errorf("changing link: %w", err)
+		}
+
 	default:
 		fmt.Println("migrate: create the schema in the database")
 		fmt.Println("seed: add data to the database")
+		fmt.Println("domains: list the branded domains")
+		fmt.Println("domain-save: create a branded domain or update its allowed domains and fallback URL")
+		fmt.Println("domain-utm: set the default UTM parameters of a branded domain's links")
+		fmt.Println("domain-interstitial: turn the warning page of a branded domain's links on or off")
+		fmt.Println("domain-delete: delete a branded domain which has no links")
+		fmt.Println("link-disable: disable a link by its code and domain")
+		fmt.Println("link-enable: enable a disabled link by its code and domain")
+		fmt.Println("link-flag: flag a link as unsafe, its visitors are always warned")
+		fmt.Println("link-unflag: clear the unsafe flag of a link")
 		fmt.Println("provide a command to get more help.")
 		return commands.ErrHelp
 	}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// batchMaxLinks limits the number of the links shortened by one batch request.
+const batchMaxLinks = 100
+
+type batchBody struct {
+	Links []shortenBody `json:"links"`
+}
+
+// batchResult is the short URL of a link of the batch or the problem it could not be shortened with.
+type batchResult struct {
+	Code     string   `json:"code,omitempty"`
+	ShortURL string   `json:"short_url,omitempty"`
+	Error    *problem `json:"error,omitempty"`
+}
+
+// handleShortenBatch handler shortens the links of the JSON body one by one, the failure of a link
+// does not stop the others. The results are in the order of the links.
+func (cfg APIConfig) handleShortenBatch(store shortener.Engine) http.HandlerFunc {
+	type batchResponse struct {
+		Results []batchResult `json:"results"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body batchBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, batchMaxLinks*shortenMaxBytes))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&body)
+		if err == nil {
+			if _, tErr := dec.Token(); !errors.Is(tErr, io.EOF) {
+				err = errors.New("data after the JSON object")
+			}
+		}
+		if err == nil && len(body.Links) > batchMaxLinks {
+			err = fmt.Errorf("batch can have at most %d links", batchMaxLinks)
+		}
+		if err != nil {
+			err = fmt.Errorf("batch body is incorrect: %w", err)
+
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("shorten batch", "ERROR", fmt.Errorf("validation body: %w", err))
+			return
+		}
+
+		resp := batchResponse{Results: make([]batchResult, 0, len(body.Links))}
+		for _, l := range body.Links {
+			link, prob := cfg.shortenLink(w, r, store, l.form(url.Values{}))
+			if prob != nil {
+				resp.Results = append(resp.Results, batchResult{Error: prob})
+				continue
+			}
+
+			resp.Results = append(resp.Results, batchResult{Code: link.Code, ShortURL: link.ShortURL})
+		}
+
+		cfg.respond(w, http.StatusOK, resp)
+	}
+}
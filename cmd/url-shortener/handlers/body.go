@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// shortenMaxBytes limits the size of the shorten request body.
+const shortenMaxBytes = 16 << 10
+
+// shortenBody is the JSON body of the shorten request. The fields are named
+// like the form values, the values are validated the same way.
+type shortenBody struct {
+	URL           string   `json:"url"`
+	Owner         string   `json:"owner"`
+	Tags          []string `json:"tags"`
+	Domain        string   `json:"domain"`
+	NotBefore     string   `json:"not_before"`
+	NotAfter      string   `json:"not_after"`
+	SoonURL       string   `json:"soon_url"`
+	EndedURL      string   `json:"ended_url"`
+	Password      string   `json:"password"`
+	MaxClicks     int64    `json:"max_clicks"`
+	Passthrough   bool     `json:"passthrough"`
+	QueryConflict string   `json:"query_conflict"`
+	UTMSource     string   `json:"utm_source"`
+	UTMMedium     string   `json:"utm_medium"`
+	UTMCampaign   string   `json:"utm_campaign"`
+	UTMDisabled   bool     `json:"utm_disabled"`
+	Warn          string   `json:"warn"`
+}
+
+// parseShortenBody reads the body of the shorten request into the request's form, so the
+// JSON and the form encoded links are validated alike. The JSON body must not have unknown
+// fields; the query string values are kept unless the body sets them.
+func parseShortenBody(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, shortenMaxBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("form is incorrect: %w", err)
+		}
+		return nil
+	}
+
+	var body shortenBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("shorten body is incorrect: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("shorten body is incorrect: data after the JSON object")
+	}
+
+	form := body.form(r.URL.Query())
+	r.Form = form
+	r.PostForm = form
+	return nil
+}
+
+// form sets the values of the body in the form. The form values the body does not set are kept.
+func (b shortenBody) form(form url.Values) url.Values {
+	set := func(name, value string) {
+		if value != "" {
+			form.Set(name, value)
+		}
+	}
+	set("url", b.URL)
+	set("owner", b.Owner)
+	set("domain", b.Domain)
+	set("not_before", b.NotBefore)
+	set("not_after", b.NotAfter)
+	set("soon_url", b.SoonURL)
+	set("ended_url", b.EndedURL)
+	set("password", b.Password)
+	set("query_conflict", b.QueryConflict)
+	set("utm_source", b.UTMSource)
+	set("utm_medium", b.UTMMedium)
+	set("utm_campaign", b.UTMCampaign)
+	set("warn", b.Warn)
+	if b.MaxClicks != 0 {
+		form.Set("max_clicks", strconv.FormatInt(b.MaxClicks, 10))
+	}
+	if b.Passthrough {
+		form.Set("passthrough", "true")
+	}
+	if b.UTMDisabled {
+		form.Set("utm_disabled", "true")
+	}
+	if b.Tags != nil {
+		form["tag"] = b.Tags
+	}
+
+	return form
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"go.uber.org/zap"
+
+	"github.com/illyasch/url-shortener/pkg/sys/metrics"
+)
+
+// DebugMux registers the debug routes of the standard library, the metrics and the
+// config of the service into a new mux. The DefaultServeMux is not used, so a dependency
+// can not inject a handler into the service without us knowing it. The config must be
+// rendered with its secrets masked, it is served as it is.
+func DebugMux(log *zap.SugaredLogger, config string, mtr *metrics.Metrics) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write([]byte(config)); err != nil {
+			log.Errorw("debug config", "ERROR", err)
+		}
+	})
+
+	if mtr != nil {
+		mux.Handle("/metrics", mtr.Handler())
+	}
+
+	return mux
+}
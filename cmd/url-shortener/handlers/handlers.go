@@ -4,117 +4,569 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 
 	"github.com/illyasch/url-shortener/pkg/business/shortener"
 	"github.com/illyasch/url-shortener/pkg/data/database"
+	"github.com/illyasch/url-shortener/pkg/sys/geoip"
+	"github.com/illyasch/url-shortener/pkg/sys/metrics"
+	"github.com/illyasch/url-shortener/pkg/sys/qrcode"
 )
 
 // APIConfig contains all the mandatory systems required by handlers.
 type APIConfig struct {
 	Log *zap.SugaredLogger
 	DB  *sqlx.DB
-}
 
-type errorResponse struct {
-	Error string `json:"error"`
+	// Store is the engine of the links. The gRPC server is given the same one, so the
+	// password attempts are limited across both APIs. An engine of DB is constructed
+	// when it is nil.
+	Store *shortener.Engine
+
+	// PublicBaseURL is the absolute URL the short links are built on,
+	// e.g. https://sho.rt/s. When empty it is taken from the request.
+	PublicBaseURL string
+
+	// PathPrefix mounts all the routes under a path, e.g. /s.
+	PathPrefix string
+
+	// Pages renders the HTML pages for browsers. The embedded templates
+	// are used when it is nil.
+	Pages *Pages
+
+	// GeoIP finds the countries of the visitors for the redirect rules.
+	// The rules matching on a country never match when it is nil.
+	GeoIP *geoip.DB
+
+	// Metrics collects the request and link metrics. Nothing is collected when it is nil.
+	Metrics *metrics.Metrics
+
+	// Sunset is the date the deprecated routes are removed on, it is sent
+	// in their Sunset header. The header is left out when it is zero.
+	Sunset time.Time
+
+	// TrustedProxies are the networks of the reverse proxies in front of the service.
+	// The clients of their requests are taken from the X-Forwarded-For header.
+	TrustedProxies []*net.IPNet
+
+	// APIKeys are the keys the clients changing the links send as their bearer tokens.
+	// The changes are refused to everyone when there are no keys.
+	APIKeys []string
 }
 
-// Router constructs a http.Handler with all application routes defined.
+// Router constructs a http.Handler with all application routes defined. Every request
+// is traced, gets an ID and is written to the access log, the panics of the handlers are
+// recovered. The trace context of the callers is taken from the W3C traceparent header.
 func (cfg APIConfig) Router() http.Handler {
 	store := shortener.New(cfg.DB)
+	if cfg.Store != nil {
+		store = *cfg.Store
+	}
+	if cfg.Pages == nil {
+		cfg.Pages = embeddedPages
+	}
 
-	router := mux.NewRouter()
-	router.HandleFunc("/{code}", cfg.handleExpand(store)).Methods(http.MethodGet)
-	router.HandleFunc("/shorten", cfg.handleShorten(store)).Methods(http.MethodPost)
+	root := mux.NewRouter()
+	router := root
+	if prefix := strings.TrimSuffix(cfg.PathPrefix, "/"); prefix != "" {
+		router = root.PathPrefix(prefix).Subrouter()
+	}
+	root.Use(cfg.nameRoute)
+
+	// The fixed paths go first, otherwise they are caught by /{code}.
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/shorten", cfg.handleShorten(store)).Methods(http.MethodPost)
+	v1.HandleFunc("/shorten/batch", cfg.handleShortenBatch(store)).Methods(http.MethodPost)
+	// The list shows the links of all the owners, so it is behind the API keys like the changes.
+	v1.Handle("/links", cfg.authorize(cfg.handleListLinks(store))).Methods(http.MethodGet)
+	v1.HandleFunc("/links/{code}", cfg.handleGetLink(store)).Methods(http.MethodGet)
+	v1.Handle("/links/{code}", cfg.authorize(cfg.handleDeleteLink(store))).Methods(http.MethodDelete)
+	v1.HandleFunc("/links/{code}/rules", cfg.handleGetRules(store)).Methods(http.MethodGet)
+	v1.Handle("/links/{code}/rules", cfg.authorize(cfg.handlePutRules(store))).Methods(http.MethodPut)
+	v1.HandleFunc("/links/{code}/variants", cfg.handleGetSplit(store)).Methods(http.MethodGet)
+	v1.Handle("/links/{code}/variants", cfg.authorize(cfg.handlePutSplit(store))).Methods(http.MethodPut)
+	v1.HandleFunc("/links/{code}/stats", cfg.handleStats(store)).Methods(http.MethodGet)
+	v1.HandleFunc("/openapi.json", cfg.handleOpenAPI).Methods(http.MethodGet)
+	v1.HandleFunc("/docs", cfg.handleDocs).Methods(http.MethodGet)
+
+	// The unversioned routes of the API are kept for the old clients until the sunset.
+	router.Handle("/shorten", cfg.deprecated("/api/v1/shorten", cfg.handleShorten(store))).Methods(http.MethodPost)
 	router.HandleFunc("/readiness", cfg.handleReadiness).Methods(http.MethodGet)
 	router.HandleFunc("/liveness", cfg.handleLiveness).Methods(http.MethodGet)
+	router.HandleFunc("/{code:[0-9A-Za-z]+}+", cfg.handlePreview(store)).Methods(http.MethodGet)
+	// The extra path qr is reserved for the QR code, the links passing paths through never get it.
+	router.HandleFunc("/{code}/qr", cfg.handleQRCode(store)).Methods(http.MethodGet)
+	router.HandleFunc("/{code}", cfg.handleExpand(store)).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/{code}/{path:.*}", cfg.handleExpand(store)).Methods(http.MethodGet, http.MethodPost)
+
+	// The span and the request ID go first, so the access log and the panics are logged with them.
+	// The metrics observe the whole router, so the requests no route matches and the panics are counted too.
+	return otelhttp.NewHandler(cfg.requestID(cfg.accessLog(cfg.observe(cfg.recoverPanic(root)))), "http.request")
+}
 
-	return router
+type shortenResponse struct {
+	Code     string `json:"code"`
+	ShortURL string `json:"short_url"`
 }
 
 // handleShorten handler saves a URL to the database and returns its id encoded to BASE62 string.
+// The link is read from a JSON or a form encoded body.
 func (cfg APIConfig) handleShorten(store shortener.Engine) http.HandlerFunc {
-	const URLMinLen = 9
-	type shortenResponse struct {
-		Code string `json:"code"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
-		url := r.FormValue("url")
-		if len(url) < URLMinLen {
-			err := errors.New("input URL is incorrect")
+		if err := parseShortenBody(w, r); err != nil {
+			cfg.Metrics.CountLink("shorten", outcomeInvalid)
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("validation body: %w", err))
+			return
+		}
 
-			cfg.respond(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
-			cfg.Log.Errorw("shorten", "ERROR", fmt.Errorf("validation url(%s): %w", url, err))
+		resp, prob := cfg.shortenLink(w, r, store, r.Form)
+		if prob != nil {
+			cfg.writeProblem(w, *prob)
 			return
 		}
 
-		code, err := store.Shorten(r.Context(), url)
+		cfg.respond(w, http.StatusOK, resp)
+	}
+}
+
+// shortenLink validates and shortens the link of the form values. The links which can not
+// be shortened are logged and returned with their problem.
+func (cfg APIConfig) shortenLink(w http.ResponseWriter, r *http.Request, store shortener.Engine, form url.Values) (shortenResponse, *problem) {
+	nl, err := parseNewLink(form)
+	if err != nil {
+		cfg.Metrics.CountLink("shorten", outcomeInvalid)
+		cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("validation url(%s): %w", nl.URL, err))
+
+		p := newProblem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return shortenResponse{}, &p
+	}
+
+	domain, err := findDomain(r, store, form.Get("domain"))
+	if err != nil {
+		cfg.Metrics.CountLink("shorten", outcome(err))
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		err := errors.New("domain is unknown")
+		cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("validation domain(%s): %w", form.Get("domain"), err))
+
+		p := newProblem(w, http.StatusBadRequest, codeDomainNotFound, err.Error())
+		return shortenResponse{}, &p
+	}
+	if err != nil {
+		cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("finding domain: %w", err))
+
+		p := failure(w, err)
+		return shortenResponse{}, &p
+	}
+
+	code, err := store.Shorten(r.Context(), domain, nl)
+	cfg.Metrics.CountLink("shorten", outcome(err))
+	if errors.Is(err, shortener.ForbiddenErr) {
+		cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("validation url(%s): %w", nl.URL, err))
+
+		p := failure(w, err)
+		return shortenResponse{}, &p
+	}
+	if err != nil {
+		cfg.log(r).Errorw("shorten", "ERROR", fmt.Errorf("shortening: %w", err))
+
+		p := failure(w, err)
+		return shortenResponse{}, &p
+	}
+
+	return shortenResponse{Code: code, ShortURL: cfg.shortURL(r, domain.Name, code)}, nil
+}
+
+// selectDomain finds the domain named by the domain form value or, if there is
+// none, the domain of the request's host.
+func selectDomain(r *http.Request, store shortener.Engine) (shortener.Domain, error) {
+	return findDomain(r, store, r.FormValue("domain"))
+}
+
+// findDomain finds the domain with the name or, if the name is empty, the domain of the request's host.
+func findDomain(r *http.Request, store shortener.Engine, name string) (shortener.Domain, error) {
+	if name != "" {
+		return store.Domain(r.Context(), name)
+	}
+
+	return store.ResolveDomain(r.Context(), requestHost(r))
+}
+
+// parseNewLink reads the link to shorten from the form values.
+func parseNewLink(form url.Values) (shortener.NewLink, error) {
+	nl := shortener.NewLink{
+		URL:   form.Get("url"),
+		Owner: form.Get("owner"),
+		Tags:  form["tag"],
+	}
+
+	// expires_at is the name not_after had before the links got activation windows.
+	for _, name := range []string{"not_before", "not_after", "expires_at"} {
+		v := form.Get(name)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			cfg.respond(w, http.StatusInternalServerError, errorResponse{
-				Error: http.StatusText(http.StatusInternalServerError),
-			})
-			cfg.Log.Errorw("shorten", "ERROR", fmt.Errorf("shortening: %w", err))
-			return
+			return nl, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
 		}
+		if name == "not_before" {
+			nl.Schedule.NotBefore = &t
+		} else {
+			nl.Schedule.NotAfter = &t
+		}
+	}
+	nl.Schedule.SoonURL = form.Get("soon_url")
+	nl.Schedule.EndedURL = form.Get("ended_url")
 
-		cfg.respond(w, http.StatusOK, shortenResponse{Code: code})
-		cfg.Log.Infow("shorten", "statusCode", http.StatusOK, "method", r.Method, "path", r.URL.Path, "remoteaddr", r.RemoteAddr)
+	if v := form.Get("max_clicks"); v != "" {
+		var err error
+		if nl.MaxClicks, err = strconv.ParseInt(v, 10, 64); err != nil || nl.MaxClicks < 1 {
+			return nl, errors.New("max_clicks must be a positive integer")
+		}
 	}
+
+	if v := form.Get("passthrough"); v != "" {
+		var err error
+		if nl.Passthrough.Enabled, err = strconv.ParseBool(v); err != nil {
+			return nl, errors.New("passthrough must be true or false")
+		}
+	}
+	nl.Passthrough.QueryConflict = form.Get("query_conflict")
+
+	nl.UTM = shortener.UTM{
+		Source:   form.Get("utm_source"),
+		Medium:   form.Get("utm_medium"),
+		Campaign: form.Get("utm_campaign"),
+	}
+	if v := form.Get("utm_disabled"); v != "" {
+		var err error
+		if nl.UTMDisabled, err = strconv.ParseBool(v); err != nil {
+			return nl, errors.New("utm_disabled must be true or false")
+		}
+	}
+
+	nl.Warn = shortener.Warn(form.Get("warn"))
+	nl.Password = form.Get("password")
+
+	return nl, nl.Validate()
 }
 
 // handleExpand handler takes the BASE62 code, decodes it and returns a corresponding URL from the database.
+// Browsers are redirected to the URL and shown an HTML page if the link can not be opened. The password of
+// a protected link is read from the X-Link-Password header or from the form browsers POST to the link.
+// The path after the code is passed through to the destination of the links allowing it. Browsers are
+// shown the interstitial page instead of the redirect when the destination is warned about.
 func (cfg APIConfig) handleExpand(store shortener.Engine) func(w http.ResponseWriter, r *http.Request) {
 	const CodeMinLen = 6
 	type expandResponse struct {
-		URL string `json:"url"`
+		URL      string `json:"url"`
+		ShortURL string `json:"short_url"`
+		Variant  string `json:"variant,omitempty"`
+		Warning  string `json:"warning,omitempty"`
 	}
-	inputErr := errors.New("input URL code is incorrect")
-
 	return func(w http.ResponseWriter, r *http.Request) {
+		html := wantsHTML(r)
+
 		code, ok := mux.Vars(r)["code"]
-		if !ok || len(code) < CodeMinLen {
-			cfg.respond(w, http.StatusBadRequest, errorResponse{Error: inputErr.Error()})
-			cfg.Log.Errorw("expand", "ERROR", fmt.Errorf("validation code(%s): %w", code, inputErr))
+		if (!ok || len(code) < CodeMinLen) && !html {
+			cfg.Metrics.CountLink("expand", outcomeDecode)
+			cfg.fail(w, shortener.DecodeErr)
+			cfg.log(r).Errorw("expand", "ERROR", fmt.Errorf("validation code(%s): %w", code, shortener.DecodeErr))
 			return
 		}
 
-		url, err := store.Expand(r.Context(), code)
+		domain, err := store.ResolveDomain(r.Context(), requestHost(r))
+		if err != nil {
+			cfg.Metrics.CountLink("expand", outcomeDBError)
+			cfg.fail(w, err)
+			cfg.log(r).Errorw("expand", "ERROR", fmt.Errorf("finding domain: %w", err))
+			return
+		}
+
+		var dest shortener.Destination
+		if len(code) < CodeMinLen {
+			err = shortener.DecodeErr
+		} else {
+			dest, err = store.Expand(r.Context(), domain, code, cfg.visit(r))
+		}
+		cfg.Metrics.CountLink("expand", outcome(err))
+
 		if err == nil {
-			cfg.respond(w, http.StatusOK, expandResponse{URL: url})
-			cfg.Log.Infow("expand", "statusCode", http.StatusOK, "method", r.Method, "path", r.URL.Path, "remoteaddr", r.RemoteAddr)
+			if dest.Sticky {
+				http.SetCookie(w, &http.Cookie{
+					Name:     variantCookie(code),
+					Value:    dest.Variant,
+					Path:     cfg.linkPath(code),
+					MaxAge:   int(variantCookieAge.Seconds()),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			if html && dest.Warning != "" {
+				cfg.warningPage(w, r, domain, code, dest)
+				return
+			}
+			if html {
+				http.Redirect(w, r, dest.URL, http.StatusFound)
+				return
+			}
+
+			cfg.respond(w, http.StatusOK, expandResponse{
+				URL:      dest.URL,
+				ShortURL: cfg.shortURL(r, domain.Name, code),
+				Variant:  dest.Variant,
+				Warning:  dest.Warning,
+			})
 			return
 		}
 
-		status := http.StatusInternalServerError
+		status, page := linkFailure(err)
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(int(shortener.PasswordAttemptsWindow.Seconds())))
+		}
 		switch {
-		case errors.Is(err, shortener.DecodeErr):
-			status = http.StatusBadRequest
-			err = fmt.Errorf("validation code(%s): %w", code, inputErr)
+		case html && page == pagePassword:
+			cfg.passwordPage(w, r, status, domain, code, err)
+		case html:
+			cfg.failurePage(w, r, domain, code, err)
+		default:
+			cfg.fail(w, err)
+		}
+		cfg.log(r).Errorw("expand", "ERROR", fmt.Errorf("expanding code(%s): %w", code, err))
+	}
+}
+
+// handlePreview handler renders an HTML page describing the link instead of redirecting to it,
+// so the visitors can check the destination before following the link. The destination of a
+// protected link is not shown, the visitors get the password form instead.
+func (cfg APIConfig) handlePreview(store shortener.Engine) http.HandlerFunc {
+	const QRCodeSize = 240
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
 
-		case errors.Is(err, sql.ErrNoRows):
-			status = http.StatusNotFound
-			err = fmt.Errorf("not found code(%s)", code)
+		domain, err := store.ResolveDomain(r.Context(), requestHost(r))
+		if err != nil {
+			domain = shortener.Domain{Name: shortener.DefaultDomain}
+			cfg.page(w, r, http.StatusInternalServerError, domain, code, pageError, nil)
+			cfg.log(r).Errorw("preview", "ERROR", fmt.Errorf("finding domain: %w", err))
+			return
 		}
 
-		cfg.respond(w, status, errorResponse{
-			Error: http.StatusText(status),
+		link, err := store.Link(r.Context(), domain, code)
+		if err == nil {
+			err = link.Check(time.Now())
+		}
+		if err != nil {
+			cfg.failurePage(w, r, domain, code, err)
+			cfg.log(r).Errorw("preview", "ERROR", fmt.Errorf("previewing code(%s): %w", code, err))
+			return
+		}
+
+		if link.Protected() {
+			cfg.passwordPage(w, r, http.StatusUnauthorized, domain, code, shortener.PasswordRequiredErr)
+			return
+		}
+
+		shortURL := cfg.shortURL(r, domain.Name, code)
+		opts := qrcode.DefaultOptions
+		opts.Size = QRCodeSize
+		png, err := qrcode.PNG(shortURL, opts)
+		if err != nil {
+			cfg.page(w, r, http.StatusInternalServerError, domain, code, pageError, nil)
+			cfg.log(r).Errorw("preview", "ERROR", fmt.Errorf("qr code(%s): %w", code, err))
+			return
+		}
+
+		cfg.page(w, r, http.StatusOK, domain, code, pagePreview, func(data *pageData) {
+			data.Title = "Preview of " + shortURL
+			data.Link = &link
+			data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
 		})
-		cfg.Log.Errorw("expand", "ERROR", fmt.Errorf("shortening: %w", err))
-		return
 	}
 }
 
+// linkFailure maps an error of opening a link to the response status and the HTML page about it.
+func linkFailure(err error) (int, string) {
+	switch {
+	case errors.Is(err, shortener.DecodeErr), errors.Is(err, shortener.TemplateErr):
+		return http.StatusBadRequest, pageNotFound
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, shortener.PassthroughErr):
+		return http.StatusNotFound, pageNotFound
+	case errors.Is(err, shortener.NotStartedErr):
+		return http.StatusNotFound, pageNotStarted
+	case errors.Is(err, shortener.ExpiredErr):
+		return http.StatusGone, pageExpired
+	case errors.Is(err, shortener.DisabledErr):
+		return http.StatusGone, pageDisabled
+	case errors.Is(err, shortener.ExhaustedErr):
+		return http.StatusGone, pageExhausted
+	case errors.Is(err, shortener.PasswordRequiredErr), errors.Is(err, shortener.PasswordErr):
+		return http.StatusUnauthorized, pagePassword
+	case errors.Is(err, shortener.RateLimitedErr):
+		return http.StatusTooManyRequests, pagePassword
+	case errors.Is(err, shortener.ForbiddenErr):
+		return http.StatusForbidden, pageError
+	case errors.Is(err, shortener.SharedErr):
+		return http.StatusConflict, pageError
+	}
+
+	return http.StatusInternalServerError, pageError
+}
+
+// failurePage shows the browser the page about a link which can not be opened because of err.
+// The visitors of unknown links are redirected to the domain's fallback URL instead if it has one,
+// and the visitors of a link outside of its schedule to the page of the window if it has one.
+func (cfg APIConfig) failurePage(w http.ResponseWriter, r *http.Request, domain shortener.Domain, code string, err error) {
+	status, page := linkFailure(err)
+
+	var windowErr *shortener.WindowErr
+	switch {
+	case errors.As(err, &windowErr) && windowErr.URL != "":
+		http.Redirect(w, r, windowErr.URL, http.StatusFound)
+	case page == pageNotFound && domain.FallbackURL != "":
+		http.Redirect(w, r, domain.FallbackURL, http.StatusFound)
+	default:
+		cfg.page(w, r, status, domain, code, page, nil)
+	}
+}
+
+// passwordPage shows the browser the password form of a protected link. The form is
+// shown with the reason when the password was wrong or the attempts are exhausted.
+func (cfg APIConfig) passwordPage(w http.ResponseWriter, r *http.Request, statusCode int, domain shortener.Domain, code string, err error) {
+	cfg.page(w, r, statusCode, domain, code, pagePassword, func(data *pageData) {
+		data.Title = "Password required"
+		switch {
+		case errors.Is(err, shortener.PasswordErr):
+			data.Error = "The password is incorrect."
+		case errors.Is(err, shortener.RateLimitedErr):
+			data.Error = "Too many failed attempts, try again later."
+		}
+	})
+}
+
+// warningPage shows the browser the interstitial page with the button continuing to the destination.
+// The button is held back for the delay of the domain.
+func (cfg APIConfig) warningPage(w http.ResponseWriter, r *http.Request, domain shortener.Domain, code string, dest shortener.Destination) {
+	cfg.page(w, r, http.StatusOK, domain, code, pageWarning, func(data *pageData) {
+		data.Title = "Leaving " + cfg.shortURL(r, domain.Name, code)
+		data.Destination = dest.URL
+		data.DestinationHost = shortener.Host(dest.URL)
+		data.Delay = domain.Interstitial.Delay
+		data.Flagged = dest.Warning == shortener.WarningFlagged
+	})
+}
+
+// visit collects the information about the visitor of a link.
+func (cfg APIConfig) visit(r *http.Request) shortener.Visit {
+	code := mux.Vars(r)["code"]
+
+	var variant string
+	if c, err := r.Cookie(variantCookie(code)); err == nil {
+		variant = c.Value
+	}
+
+	// The extra path is cut from the escaped path, so the escaping the visitor used is kept.
+	var path string
+	if _, ok := mux.Vars(r)["path"]; ok {
+		path = strings.TrimPrefix(r.URL.EscapedPath(), cfg.linkPath(code))
+	}
+
+	return shortener.Visit{
+		Password:       linkPassword(r),
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Country:        cfg.GeoIP.Country(cfg.remoteIP(r)),
+		Query:          r.URL.Query(),
+		Variant:        variant,
+		Path:           path,
+	}
+}
+
+// variantCookieAge is how long the visitors of a sticky split link stay on their variant.
+const variantCookieAge = 30 * 24 * time.Hour
+
+// variantCookie returns the name of the cookie remembering the variant of the link with the code.
+func variantCookie(code string) string {
+	return "variant_" + code
+}
+
+// remoteIP returns the IP address of the client the request comes from. The requests of the
+// trusted proxies come from the last address of X-Forwarded-For which is not a trusted proxy;
+// the addresses before it are not checked as the client can forge them.
+func (cfg APIConfig) remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if !cfg.trustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !cfg.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trustedProxy reports whether the address belongs to a trusted proxy.
+func (cfg APIConfig) trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range cfg.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linkPassword returns the password the visitor provided for a protected link.
+func linkPassword(r *http.Request) string {
+	if v := r.Header.Get("X-Link-Password"); v != "" {
+		return v
+	}
+	if r.Method == http.MethodPost {
+		return r.PostFormValue("password")
+	}
+
+	return ""
+}
+
 // handleReadiness checks if the database is ready and if not will return a 500 status if it's not.
 func (cfg APIConfig) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
@@ -125,7 +577,7 @@ func (cfg APIConfig) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	if err := database.StatusCheck(ctx, cfg.DB); err != nil {
 		status = "db not ready"
 		statusCode = http.StatusInternalServerError
-		cfg.Log.Errorw("readiness", "ERROR", fmt.Errorf("status check: %w", err))
+		cfg.log(r).Errorw("readiness", "ERROR", fmt.Errorf("status check: %w", err))
 	}
 
 	data := struct {
@@ -135,7 +587,6 @@ func (cfg APIConfig) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cfg.respond(w, statusCode, data)
-	cfg.Log.Infow("readiness", "statusCode", statusCode, "method", r.Method, "path", r.URL.Path, "remoteaddr", r.RemoteAddr)
 }
 
 // handleLiveness returns simple status info if the service is alive. If the
@@ -165,12 +616,92 @@ func (cfg APIConfig) handleLiveness(w http.ResponseWriter, r *http.Request) {
 		Namespace: os.Getenv("KUBERNETES_NAMESPACE"),
 	}
 
-	statusCode := http.StatusOK
-	cfg.respond(w, statusCode, data)
-	cfg.Log.Infow("liveness", "statusCode", statusCode, "method", r.Method, "path", r.URL.Path, "remoteaddr", r.RemoteAddr)
+	cfg.respond(w, http.StatusOK, data)
+}
+
+// baseURL returns the absolute URL the routes of a domain are served from.
+// It is the configured public base URL or, if there is none, the request's
+// host with the path prefix. The branded domains replace the host.
+func (cfg APIConfig) baseURL(r *http.Request, domain string) string {
+	branded := domain != shortener.DefaultDomain
+
+	if cfg.PublicBaseURL != "" {
+		base := strings.TrimSuffix(cfg.PublicBaseURL, "/")
+		if !branded {
+			return base
+		}
+
+		u, err := url.Parse(base)
+		if err != nil {
+			return base
+		}
+		u.Host = domain
+		return u.String()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host := r.Host
+	if branded && requestHost(r) != domain {
+		host = domain
+	}
+
+	return scheme + "://" + host + strings.TrimSuffix(cfg.PathPrefix, "/")
+}
+
+// linkPath returns the path of the link with the code.
+func (cfg APIConfig) linkPath(code string) string {
+	return strings.TrimSuffix(cfg.PathPrefix, "/") + "/" + code
+}
+
+// shortURL builds the full short URL of a code in a domain.
+func (cfg APIConfig) shortURL(r *http.Request, domain string, code string) string {
+	return cfg.baseURL(r, domain) + "/" + code
+}
+
+// requestHost returns the lower-cased host name of the request without a port.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	return strings.ToLower(host)
+}
+
+// wantsHTML reports whether the request is made by a browser rather than an API client.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// page renders an HTML page about the link with the code in the domain.
+// The page specific data is filled in by the optional fill function.
+func (cfg APIConfig) page(w http.ResponseWriter, r *http.Request, statusCode int, domain shortener.Domain, code string, name string, fill func(*pageData)) {
+	data := pageData{
+		Title:    http.StatusText(statusCode),
+		Domain:   domain.Name,
+		Code:     code,
+		ShortURL: cfg.shortURL(r, domain.Name, code),
+		HomeURL:  domain.FallbackURL,
+	}
+	if fill != nil {
+		fill(&data)
+	}
+
+	if err := cfg.Pages.Render(w, statusCode, domain.Name, name, data); err != nil {
+		cfg.log(r).Errorw("page", "ERROR", fmt.Errorf("render %s: %w", name, err))
+	}
 }
 
 func (cfg APIConfig) respond(w http.ResponseWriter, statusCode int, data any) {
+	cfg.respondAs(w, statusCode, "application/json", data)
+}
+
+// respondAs writes the data as JSON of the content type.
+func (cfg APIConfig) respondAs(w http.ResponseWriter, statusCode int, contentType string, data any) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -178,7 +709,7 @@ func (cfg APIConfig) respond(w http.ResponseWriter, statusCode int, data any) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(statusCode)
 
 	if _, err := w.Write(jsonData); err != nil {
@@ -1,34 +1,66 @@
 package handlers_test
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/ardanlabs/conf/v3"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/illyasch/url-shortener/cmd/url-shortener/handlers"
 	"github.com/illyasch/url-shortener/pkg/business/shortener"
-	"github.com/illyasch/url-shortener/pkg/data/database"
+	"github.com/illyasch/url-shortener/pkg/data/database/dbtest"
 	"github.com/illyasch/url-shortener/pkg/sys/logger"
+	"github.com/illyasch/url-shortener/pkg/sys/metrics"
 )
 
+// defaultLinkSQL selects a code id and URL of any plain link in the default domain, the link
+// which is shared and redirects to its URL without a password, a limit, a window or a warning.
+const defaultLinkSQL = `SELECT u.code_id, u.url FROM urls u JOIN domains d ON d.id = u.domain_id
+	WHERE d.name = 'default' AND u.shared AND NOT u.disabled AND NOT u.flagged AND u.password_hash = ''
+		AND u.clicks_left IS NULL AND u.not_before IS NULL AND u.not_after IS NULL AND u.rules = '[]'
+		AND u.split = '{}' AND NOT u.passthrough AND u.utm_source = '' AND u.utm_medium = ''
+		AND u.utm_campaign = '' AND u.warn = '' AND u.url NOT LIKE '%{%' AND NOT d.interstitial
+		AND d.utm_source = '' AND d.utm_medium = '' AND d.utm_campaign = ''
+	LIMIT 1`
+
+// apiKey is the API key of the routers of the tests changing the links.
+const apiKey = "test-api-key"
+
 var (
 	postgresDB *sqlx.DB
 	stdLgr     *zap.SugaredLogger
+
+	// spans records the spans of all the tests in memory.
+	spans *tracetest.SpanRecorder
 )
 
 func TestMain(m *testing.M) {
@@ -38,40 +70,11 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
-	cfg := struct {
-		conf.Version
-		DB struct {
-			User         string `conf:"default:postgres"`
-			Password     string `conf:"default:nimda,mask"`
-			Host         string `conf:"default:localhost"`
-			Name         string `conf:"default:postgres"`
-			MaxIdleConns int    `conf:"default:0"`
-			MaxOpenConns int    `conf:"default:0"`
-			DisableTLS   bool   `conf:"default:true"`
-		}
-	}{
-		Version: conf.Version{
-			Build: "test",
-			Desc:  "Copyright Ilya Scheblanov",
-		},
-	}
-
-	const prefix = "SHORTENER"
-	_, err = conf.Parse(prefix, &cfg)
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Println(cfg)
+	spans = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	postgresDB, err = database.Open(database.Config{
-		User:         cfg.DB.User,
-		Password:     cfg.DB.Password,
-		Host:         cfg.DB.Host,
-		Name:         cfg.DB.Name,
-		MaxIdleConns: cfg.DB.MaxIdleConns,
-		MaxOpenConns: cfg.DB.MaxOpenConns,
-		DisableTLS:   cfg.DB.DisableTLS,
-	})
+	postgresDB, err = dbtest.Open()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -107,7 +110,7 @@ func TestAPIConfig_handleShorten(t *testing.T) {
 		assert.NotEmpty(t, got.Code)
 
 		var id int64
-		err = cfg.DB.QueryRowx("SELECT id FROM urls WHERE url = $1", expURL).Scan(&id)
+		err = cfg.DB.QueryRowx("SELECT code_id FROM urls WHERE url = $1", expURL).Scan(&id)
 		require.NoError(t, err)
 		assert.Equal(t, shortener.Encode(id), got.Code)
 	})
@@ -125,12 +128,15 @@ func TestAPIConfig_handleShorten(t *testing.T) {
 		cfg.Router().ServeHTTP(w, r)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
 		var got struct {
-			Error string `json:"error"`
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
 		}
 		err := json.NewDecoder(w.Body).Decode(&got)
 		require.NoError(t, err)
-		assert.NotEmpty(t, got.Error)
+		assert.Equal(t, "invalid_request", got.Code)
+		assert.NotEmpty(t, got.Detail)
 	})
 
 	t.Run("previously existed URL", func(t *testing.T) {
@@ -138,7 +144,7 @@ func TestAPIConfig_handleShorten(t *testing.T) {
 
 		var expID int64
 		var expURL string
-		err := cfg.DB.QueryRowx("SELECT id, url FROM urls LIMIT 1").Scan(&expID, &expURL)
+		err := cfg.DB.QueryRowx(defaultLinkSQL).Scan(&expID, &expURL)
 		if err != nil {
 			t.Skip("select any existed row", err)
 		}
@@ -162,6 +168,55 @@ func TestAPIConfig_handleShorten(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, shortener.Encode(expID), got.Code)
 	})
+
+	t.Run("owned and tagged links are not shared", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/owned/" + uuid.NewString()
+		shorten := func(owner, tag string) string {
+			vals := url.Values{}
+			vals.Set("url", expURL)
+			if owner != "" {
+				vals.Set("owner", owner)
+			}
+			if tag != "" {
+				vals.Set("tag", tag)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+			r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			cfg.Router().ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var got struct {
+				Code string `json:"code"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			return got.Code
+		}
+
+		plain := shorten("", "")
+		assert.Equal(t, plain, shorten("", ""))
+
+		owner := uuid.NewString()
+		codes := map[string]bool{
+			plain:                          true,
+			shorten(owner, ""):             true,
+			shorten(uuid.NewString(), ""):  true,
+			shorten("", "tag-"+owner):      true,
+			shorten(owner, "other-"+owner): true,
+		}
+		assert.Len(t, codes, 5)
+
+		var gotOwner string
+		id, err := shortener.Decode(shorten(owner, ""))
+		require.NoError(t, err)
+		err = cfg.DB.QueryRowx(`SELECT u.owner FROM urls u JOIN domains d ON d.id = u.domain_id
+			WHERE d.name = 'default' AND u.code_id = $1`, id).Scan(&gotOwner)
+		require.NoError(t, err)
+		assert.Equal(t, owner, gotOwner)
+	})
 }
 
 func TestAPIConfig_handleExpand(t *testing.T) {
@@ -180,12 +235,15 @@ func TestAPIConfig_handleExpand(t *testing.T) {
 		cfg.Router().ServeHTTP(w, r)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
 		var got struct {
-			Error string `json:"error"`
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
 		}
 		err := json.NewDecoder(w.Body).Decode(&got)
 		require.NoError(t, err)
-		assert.NotEmpty(t, got.Error)
+		assert.Equal(t, "invalid_code", got.Code)
+		assert.NotEmpty(t, got.Detail)
 	})
 
 	t.Run("successful finding an URL with the code", func(t *testing.T) {
@@ -193,7 +251,7 @@ func TestAPIConfig_handleExpand(t *testing.T) {
 
 		var expID int64
 		var expURL string
-		err := cfg.DB.QueryRowx("SELECT id, url FROM urls LIMIT 1").Scan(&expID, &expURL)
+		err := cfg.DB.QueryRowx(defaultLinkSQL).Scan(&expID, &expURL)
 		if err != nil {
 			t.Skip("select any existed row", err)
 		}
@@ -221,12 +279,15 @@ func TestAPIConfig_handleExpand(t *testing.T) {
 		cfg.Router().ServeHTTP(w, r)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
 		var got struct {
-			Error string `json:"error"`
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
 		}
 		err := json.NewDecoder(w.Body).Decode(&got)
 		require.NoError(t, err)
-		assert.NotEmpty(t, got.Error)
+		assert.Equal(t, "invalid_code", got.Code)
+		assert.NotEmpty(t, got.Detail)
 	})
 
 	t.Run("not found an URL error", func(t *testing.T) {
@@ -239,7 +300,8 @@ func TestAPIConfig_handleExpand(t *testing.T) {
 			id = rand.Int63n(shortener.EncShift*10) + shortener.EncShift*10
 
 			var url string
-			err = cfg.DB.QueryRowx("SELECT url FROM urls WHERE id = $1", id).Scan(&url)
+			err = cfg.DB.QueryRowx(`SELECT u.url FROM urls u JOIN domains d ON d.id = u.domain_id
+				WHERE d.name = 'default' AND u.code_id = $1`, id).Scan(&url)
 			if errors.Is(sql.ErrNoRows, err) {
 				break
 			}
@@ -254,11 +316,2121 @@ func TestAPIConfig_handleExpand(t *testing.T) {
 		cfg.Router().ServeHTTP(w, r)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
 		var got struct {
-			Error string `json:"error"`
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
 		}
 		err = json.NewDecoder(w.Body).Decode(&got)
 		require.NoError(t, err)
-		assert.NotEmpty(t, got.Error)
+		assert.Equal(t, "not_found", got.Code)
+		assert.NotEmpty(t, got.Detail)
+	})
+}
+
+func TestAPIConfig_handleListLinks(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}
+
+	type listResponse struct {
+		Links []struct {
+			Code     string   `json:"code"`
+			ShortURL string   `json:"short_url"`
+			URL      string   `json:"url"`
+			Owner    string   `json:"owner"`
+			Tags     []string `json:"tags"`
+		} `json:"links"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	owner := uuid.NewString()
+	var expURLs []string
+	for i := 0; i < 3; i++ {
+		expURL := "https://www.listurl.com/" + uuid.NewString()
+		vals := url.Values{}
+		vals.Set("url", expURL)
+		vals.Set("owner", owner)
+		vals.Add("tag", "list")
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		expURLs = append(expURLs, expURL)
+	}
+
+	t.Run("paginated listing by owner", func(t *testing.T) {
+		t.Parallel()
+
+		var gotURLs []string
+		cursor := ""
+		for page := 0; page < 3; page++ {
+			q := url.Values{}
+			q.Set("owner", owner)
+			q.Set("order", "asc")
+			q.Set("limit", "2")
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/links?"+q.Encode(), nil)
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w := httptest.NewRecorder()
+
+			cfg.Router().ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var got listResponse
+			err := json.NewDecoder(w.Body).Decode(&got)
+			require.NoError(t, err)
+
+			for _, l := range got.Links {
+				assert.Equal(t, owner, l.Owner)
+				assert.Equal(t, []string{"list"}, l.Tags)
+				assert.True(t, strings.HasSuffix(l.ShortURL, "/"+l.Code))
+				gotURLs = append(gotURLs, l.URL)
+			}
+
+			cursor = got.NextCursor
+			if cursor == "" {
+				break
+			}
+		}
+
+		assert.Equal(t, expURLs, gotURLs)
+	})
+
+	t.Run("search by destination URL", func(t *testing.T) {
+		t.Parallel()
+
+		q := url.Values{}
+		q.Set("q", expURLs[1][len("https://www.listurl.com/"):])
+		q.Set("domain", "listurl.com")
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links?"+q.Encode(), nil)
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var got listResponse
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		require.Len(t, got.Links, 1)
+		assert.Equal(t, expURLs[1], got.Links[0].URL)
+		assert.Empty(t, got.NextCursor)
+	})
+
+	t.Run("filter by destination and branded domains", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			query string
+			exp   int
+		}{
+			{"domain=listurl.com", 3},
+			{"host=listurl.com", 3},
+			{"domain=testurl.com", 0},
+			{"branded_domain=default", 3},
+			{"branded_domain=" + uuid.NewString() + ".example", 0},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/links?owner="+owner+"&"+tt.query, nil)
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w := httptest.NewRecorder()
+
+			cfg.Router().ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code, tt.query)
+			var got listResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Len(t, got.Links, tt.exp, tt.query)
+		}
+	})
+
+	t.Run("API key is required", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links?owner="+owner, nil)
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotContains(t, w.Body.String(), owner)
+	})
+
+	t.Run("query validation error", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links?limit=1000", nil)
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var got struct {
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		assert.Equal(t, "invalid_request", got.Code)
+		assert.NotEmpty(t, got.Detail)
+	})
+}
+
+func TestAPIConfig_PublicBaseURL(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log:           stdLgr,
+		DB:            postgresDB,
+		PublicBaseURL: "https://sho.rt/s/",
+		PathPrefix:    "/s",
+	}
+
+	t.Run("routes are mounted under the path prefix", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/s/liveness", nil)
+		w := httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		r = httptest.NewRequest(http.MethodGet, "/liveness", nil)
+		w = httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("short URL is built on the public base URL", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/base/"+uuid.NewString())
+		r := httptest.NewRequest(http.MethodPost, "/s/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			Code     string `json:"code"`
+			ShortURL string `json:"short_url"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		assert.Equal(t, "https://sho.rt/s/"+got.Code, got.ShortURL)
+
+		r = httptest.NewRequest(http.MethodGet, "/s/"+got.Code, nil)
+		w = httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var exp struct {
+			ShortURL string `json:"short_url"`
+		}
+		err = json.NewDecoder(w.Body).Decode(&exp)
+		require.NoError(t, err)
+		assert.Equal(t, got.ShortURL, exp.ShortURL)
+	})
+}
+
+func TestAPIConfig_brandedDomains(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}
+
+	store := shortener.New(postgresDB)
+	domain := uuid.NewString() + ".example"
+	err := store.SaveDomain(context.Background(), shortener.Domain{
+		Name:           domain,
+		AllowedDomains: []string{"allowed.example"},
+		FallbackURL:    "https://allowed.example/home",
+	})
+	require.NoError(t, err)
+
+	shorten := func(t *testing.T, vals url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("code is resolved by the host", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.allowed.example/" + uuid.NewString()
+		vals := url.Values{}
+		vals.Set("url", expURL)
+		vals.Set("domain", domain)
+		w := shorten(t, vals)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			Code     string `json:"code"`
+			ShortURL string `json:"short_url"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		assert.Equal(t, "http://"+domain+"/"+got.Code, got.ShortURL)
+
+		r := httptest.NewRequest(http.MethodGet, "/"+got.Code, nil)
+		r.Host = domain
+		w = httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var exp struct {
+			URL string `json:"url"`
+		}
+		err = json.NewDecoder(w.Body).Decode(&exp)
+		require.NoError(t, err)
+		assert.Equal(t, expURL, exp.URL)
+	})
+
+	t.Run("destination is not allowed", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/"+uuid.NewString())
+		vals.Set("domain", domain)
+		w := shorten(t, vals)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/"+uuid.NewString())
+		vals.Set("domain", uuid.NewString()+".example")
+		w := shorten(t, vals)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("miss is redirected to the fallback URL", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/"+shortener.Encode(shortener.EncShift*10), nil)
+		r.Host = domain
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://allowed.example/home", w.Header().Get("Location"))
+	})
+}
+
+func TestAPIConfig_pages(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}
+
+	shorten := func(t *testing.T, vals url.Values) string {
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		return got.Code
+	}
+
+	browse := func(code string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		r.Header.Set("Accept", "text/html,application/xhtml+xml")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("browser is redirected to the URL", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/page/" + uuid.NewString()
+		vals := url.Values{}
+		vals.Set("url", expURL)
+		w := browse(shorten(t, vals))
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, expURL, w.Header().Get("Location"))
+	})
+
+	t.Run("expired link page", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/page/"+uuid.NewString())
+		vals.Set("expires_at", time.Now().Add(-time.Hour).Format(time.RFC3339))
+		w := browse(shorten(t, vals))
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), "expired")
+	})
+
+	t.Run("scheduled link windows", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/campaign/"+uuid.NewString())
+		vals.Set("not_before", time.Now().Add(time.Hour).Format(time.RFC3339))
+		vals.Set("soon_url", "https://www.testurl.com/soon")
+		w := browse(shorten(t, vals))
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://www.testurl.com/soon", w.Header().Get("Location"))
+
+		vals.Del("soon_url")
+		w = browse(shorten(t, vals))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Coming soon")
+
+		vals = url.Values{}
+		vals.Set("url", "https://www.testurl.com/campaign/"+uuid.NewString())
+		vals.Set("not_after", time.Now().Add(-time.Hour).Format(time.RFC3339))
+		vals.Set("ended_url", "https://www.testurl.com/ended")
+		w = browse(shorten(t, vals))
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://www.testurl.com/ended", w.Header().Get("Location"))
+	})
+
+	t.Run("disabled link page", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/page/"+uuid.NewString())
+		code := shorten(t, vals)
+
+		store := shortener.New(postgresDB)
+		domain, err := store.Domain(context.Background(), shortener.DefaultDomain)
+		require.NoError(t, err)
+		err = store.SetDisabled(context.Background(), domain, code, true)
+		require.NoError(t, err)
+
+		w := browse(code)
+
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Body.String(), "disabled")
+	})
+
+	t.Run("preview page", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/preview/" + uuid.NewString()
+		vals := url.Values{}
+		vals.Set("url", expURL)
+		code := shorten(t, vals)
+
+		r := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		w := httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		r = httptest.NewRequest(http.MethodGet, "/"+code+"+", nil)
+		w = httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), expURL)
+		assert.Contains(t, w.Body.String(), "1 clicks")
+		assert.Contains(t, w.Body.String(), "data:image/png;base64,")
+	})
+
+	t.Run("not found page", func(t *testing.T) {
+		t.Parallel()
+
+		w := browse("favicon.ico")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), "Link not found")
+	})
+}
+
+func TestAPIConfig_passwordLinks(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}.Router()
+
+	shorten := func(t *testing.T, expURL string) string {
+		vals := url.Values{}
+		vals.Set("url", expURL)
+		vals.Set("password", "s3cret")
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		return got.Code
+	}
+
+	post := func(code string, password string) *httptest.ResponseRecorder {
+		vals := url.Values{}
+		vals.Set("password", password)
+		r := httptest.NewRequest(http.MethodPost, "/"+code, strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("browser gets the password form", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/secret/" + uuid.NewString()
+		code := shorten(t, expURL)
+
+		r := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `name="password"`)
+		assert.NotContains(t, w.Body.String(), expURL)
+
+		w = post(code, "s3cret")
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, expURL, w.Header().Get("Location"))
+	})
+
+	t.Run("JSON API reads the password header", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/secret/" + uuid.NewString()
+		code := shorten(t, expURL)
+
+		tests := []struct {
+			name     string
+			password string
+			expCode  int
+		}{
+			{"no password", "", http.StatusUnauthorized},
+			{"wrong password", "guess", http.StatusUnauthorized},
+			{"correct password", "s3cret", http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+			if tt.password != "" {
+				r.Header.Set("X-Link-Password", tt.password)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expCode, w.Code, tt.name)
+		}
+	})
+
+	t.Run("failed attempts are rate limited", func(t *testing.T) {
+		t.Parallel()
+
+		code := shorten(t, "https://www.testurl.com/secret/"+uuid.NewString())
+
+		for i := 0; i < shortener.MaxPasswordAttempts; i++ {
+			w := post(code, "guess")
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), "password is incorrect")
+		}
+
+		w := post(code, "s3cret")
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("concurrent attempts are rate limited", func(t *testing.T) {
+		t.Parallel()
+
+		code := shorten(t, "https://www.testurl.com/secret/"+uuid.NewString())
+
+		const guesses = 4 * shortener.MaxPasswordAttempts
+		statuses := make(chan int, guesses)
+		var wg sync.WaitGroup
+		for i := 0; i < guesses; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses <- post(code, "guess").Code
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		counts := map[int]int{}
+		for status := range statuses {
+			counts[status]++
+		}
+		assert.Equal(t, shortener.MaxPasswordAttempts, counts[http.StatusUnauthorized])
+		assert.Equal(t, guesses-shortener.MaxPasswordAttempts, counts[http.StatusTooManyRequests])
+	})
+
+	t.Run("API does not show the destinations", func(t *testing.T) {
+		t.Parallel()
+
+		search := uuid.NewString()
+		expURL := "https://www.testurl.com/secret/" + search
+		code := shorten(t, expURL)
+
+		put := func(path, body string) {
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+code+path, strings.NewReader(body))
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		put("/rules", `{"rules":[{"platform":"ios","url":"https://www.testurl.com/ios/`+search+`"}]}`)
+		put("/variants", `{"variants":[{"name":"a","url":"https://www.testurl.com/a/`+search+`","weight":1}]}`)
+
+		tests := []struct {
+			name   string
+			target string
+			exp    string
+		}{
+			{"get link", "/api/v1/links/" + code, `"protected":true`},
+			{"rules", "/api/v1/links/" + code + "/rules", `"platform":"ios"`},
+			{"variants", "/api/v1/links/" + code + "/variants", `"name":"a"`},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code, tt.name)
+			assert.Contains(t, w.Body.String(), tt.exp, tt.name)
+			assert.NotContains(t, w.Body.String(), search, tt.name)
+		}
+	})
+
+	t.Run("destination filters do not match", func(t *testing.T) {
+		t.Parallel()
+
+		owner, search := uuid.NewString(), uuid.NewString()
+		vals := url.Values{}
+		vals.Set("url", "https://secret.testurl.com/"+search)
+		vals.Set("owner", owner)
+		vals.Set("password", "s3cret")
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		list := func(query string) string {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/links?owner="+owner+query, nil)
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code, query)
+			return w.Body.String()
+		}
+
+		body := list("")
+		assert.Contains(t, body, `"protected":true`)
+		assert.NotContains(t, body, search)
+
+		for _, probe := range []string{"&q=" + search, "&q=secret", "&domain=secret.testurl.com", "&domain=testurl.com"} {
+			assert.NotContains(t, list(probe), `"protected":true`, probe)
+		}
+	})
+
+	t.Run("preview does not show the destination", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/secret/" + uuid.NewString()
+		code := shorten(t, expURL)
+
+		r := httptest.NewRequest(http.MethodGet, "/"+code+"+", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotContains(t, w.Body.String(), expURL)
+	})
+}
+
+func TestAPIConfig_maxClicks(t *testing.T) {
+	t.Parallel()
+	const (
+		maxClicks = 3
+		visitors  = 10
+	)
+	router := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}.Router()
+
+	vals := url.Values{}
+	vals.Set("url", "https://www.testurl.com/once/"+uuid.NewString())
+	vals.Set("max_clicks", strconv.Itoa(maxClicks))
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&got)
+	require.NoError(t, err)
+
+	// The visitors expand the link concurrently, only maxClicks of them may open it.
+	var wg sync.WaitGroup
+	codes := make(chan int, visitors)
+	for i := 0; i < visitors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodGet, "/"+got.Code, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	count := map[int]int{}
+	for code := range codes {
+		count[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: maxClicks, http.StatusGone: visitors - maxClicks}, count)
+
+	t.Run("invalid max_clicks", func(t *testing.T) {
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/once/"+uuid.NewString())
+		vals.Set("max_clicks", "0")
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAPIConfig_rules(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}.Router()
+
+	const appStore = "https://apps.apple.com/app/id1"
+	expURL := "https://www.testurl.com/app/" + uuid.NewString()
+	vals := url.Values{}
+	vals.Set("url", expURL)
+	// The tagged link is not shared, so its rules can be changed.
+	vals.Set("tag", "rules")
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&got)
+	require.NoError(t, err)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/rules", strings.NewReader(body))
+		r.Header.Add("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w = put(`{"rules":[{"platform":"ios","url":"` + appStore + `"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	t.Run("rules are returned", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links/"+got.Code+"/rules", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Rules []shortener.Rule `json:"rules"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&body)
+		require.NoError(t, err)
+		assert.Equal(t, []shortener.Rule{{Platform: shortener.PlatformIOS, URL: appStore}}, body.Rules)
+	})
+
+	t.Run("expand evaluates the rules", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			userAgent string
+			exp       string
+		}{
+			{"matching rule", "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X)", appStore},
+			{"no matching rule", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", expURL},
+		}
+
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/"+got.Code, nil)
+			r.Header.Set("Accept", "text/html")
+			r.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusFound, w.Code, tt.name)
+			assert.Equal(t, tt.exp, w.Header().Get("Location"), tt.name)
+		}
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		w := put(`{"rules":[{"platform":"symbian","url":"https://www.testurl.com"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = put(`{"rules":[{"url":"https://www.testurl.com","device":"ios"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("API key is required", func(t *testing.T) {
+		for _, authorization := range []string{"", "Bearer", "Bearer wrong", "Basic " + apiKey} {
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/rules", strings.NewReader(`{"rules":[]}`))
+			if authorization != "" {
+				r.Header.Set("Authorization", authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+			assert.Contains(t, w.Body.String(), `"code":"unauthorized"`, authorization)
+		}
+
+		noKeys := handlers.APIConfig{Log: stdLgr, DB: postgresDB}.Router()
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/rules", strings.NewReader(`{"rules":[]}`))
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		noKeys.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("rules of shared links are refused", func(t *testing.T) {
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/app/"+uuid.NewString())
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var shared struct {
+			Code string `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&shared))
+
+		body := `{"rules":[{"platform":"ios","url":"` + appStore + `"}]}`
+		r = httptest.NewRequest(http.MethodPut, "/api/v1/links/"+shared.Code+"/rules", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"link_shared"`)
+	})
+}
+
+func TestAPIConfig_variants(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}.Router()
+
+	vals := url.Values{}
+	vals.Set("url", "https://www.testurl.com/landing/"+uuid.NewString())
+	// The tagged link is not shared, so its variants can be changed.
+	vals.Set("tag", "variants")
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&got)
+	require.NoError(t, err)
+
+	body := `{"sticky":true,"variants":[{"name":"a","url":"https://www.testurl.com/a","weight":1},` +
+		`{"name":"b","url":"https://www.testurl.com/b","weight":1}]}`
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/variants", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+apiKey)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The first visit assigns a variant, the cookie keeps the visitor on it.
+	r = httptest.NewRequest(http.MethodGet, "/"+got.Code, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var first struct {
+		URL     string `json:"url"`
+		Variant string `json:"variant"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&first)
+	require.NoError(t, err)
+	require.Contains(t, []string{"a", "b"}, first.Variant)
+	assert.Equal(t, "https://www.testurl.com/"+first.Variant, first.URL)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	const visits = 5
+	for i := 0; i < visits; i++ {
+		r = httptest.NewRequest(http.MethodGet, "/"+got.Code, nil)
+		r.Header.Set("Accept", "text/html")
+		r.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, first.URL, w.Header().Get("Location"))
+	}
+
+	t.Run("stats break the clicks down by variant", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links/"+got.Code+"/stats", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var stats struct {
+			Clicks   int64 `json:"clicks"`
+			Variants []struct {
+				Variant string `json:"variant"`
+				Clicks  int64  `json:"clicks"`
+			} `json:"variants"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&stats)
+		require.NoError(t, err)
+
+		assert.EqualValues(t, visits+1, stats.Clicks)
+		require.Len(t, stats.Variants, 1)
+		assert.Equal(t, first.Variant, stats.Variants[0].Variant)
+		assert.EqualValues(t, visits+1, stats.Variants[0].Clicks)
+	})
+
+	t.Run("invalid variants", func(t *testing.T) {
+		body := `{"variants":[{"name":"a","url":"https://www.testurl.com/a","weight":0}]}`
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/variants", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("API key is required", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/links/"+got.Code+"/variants", strings.NewReader(`{"variants":[]}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+	})
+
+	t.Run("variants of shared links are refused", func(t *testing.T) {
+		vals := url.Values{}
+		vals.Set("url", "https://www.testurl.com/landing/"+uuid.NewString())
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var shared struct {
+			Code string `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&shared))
+
+		r = httptest.NewRequest(http.MethodPut, "/api/v1/links/"+shared.Code+"/variants", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"link_shared"`)
+	})
+}
+
+func TestAPIConfig_passthrough(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}.Router()
+
+	shorten := func(t *testing.T, vals url.Values) string {
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		return got.Code
+	}
+
+	base := "https://docs.testurl.com/" + uuid.NewString()
+	vals := url.Values{}
+	vals.Set("url", base+"?lang=en")
+	vals.Set("passthrough", "true")
+	vals.Set("query_conflict", "override")
+	code := shorten(t, vals)
+
+	plain := url.Values{}
+	plain.Set("url", base)
+	plainCode := shorten(t, plain)
+
+	tests := []struct {
+		name    string
+		target  string
+		expCode int
+		expURL  string
+	}{
+		{"path and query", "/" + code + "/guide/a%20b?x=1&lang=de", http.StatusFound, base + "/guide/a%20b?lang=de&x=1"},
+		{"query only", "/" + code + "?x=1", http.StatusFound, base + "?lang=en&x=1"},
+		{"link without passthrough", "/" + plainCode + "/guide", http.StatusNotFound, ""},
+		{"path under the reserved qr path", "/" + code + "/qr/code", http.StatusFound, base + "/qr/code?lang=en"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("Accept", "text/html")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expCode, w.Code)
+			assert.Equal(t, tt.expURL, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("reserved qr path", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/"+code+"/qr", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("invalid query_conflict", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", base)
+		vals.Set("passthrough", "true")
+		vals.Set("query_conflict", "merge")
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAPIConfig_templates(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}.Router()
+
+	shorten := func(rawURL string) *httptest.ResponseRecorder {
+		vals := url.Values{}
+		vals.Set("url", rawURL)
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	shop := "https://shop.testurl.com/" + uuid.NewString()
+	w := shorten(shop + "/{1}?ref={ref|direct}")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&got)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		target  string
+		expCode int
+		expURL  string
+	}{
+		{"filled from path and query", "/" + got.Code + "/A-42?ref=mail", http.StatusFound, shop + "/A-42?ref=mail"},
+		{"default value", "/" + got.Code + "/A-42", http.StatusFound, shop + "/A-42?ref=direct"},
+		{"missing value", "/" + got.Code, http.StatusBadRequest, ""},
+		{"disallowed characters", "/" + got.Code + "/A-42?ref=%40evil", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("Accept", "text/html")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expCode, w.Code)
+			assert.Equal(t, tt.expURL, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("placeholder in the host", func(t *testing.T) {
+		t.Parallel()
+
+		w := shorten("https://{shop}.testurl.com/item")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAPIConfig_UTM(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}.Router()
+
+	store := shortener.New(postgresDB)
+	domain := uuid.NewString() + ".example"
+	err := store.SaveDomain(context.Background(), shortener.Domain{Name: domain})
+	require.NoError(t, err)
+	err = store.SetDomainUTM(context.Background(), domain, shortener.UTM{Source: "shortener", Medium: "link"})
+	require.NoError(t, err)
+
+	expand := func(t *testing.T, vals url.Values) string {
+		vals.Set("domain", domain)
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+
+		r = httptest.NewRequest(http.MethodGet, "http://"+domain+"/"+got.Code, nil)
+		r.Header.Set("Accept", "text/html")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusFound, w.Code)
+
+		return w.Header().Get("Location")
+	}
+
+	dest := "https://www.testurl.com/" + uuid.NewString()
+
+	t.Run("link and domain parameters", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", dest+"?utm_medium=mail")
+		vals.Set("utm_campaign", "summer")
+
+		assert.Equal(t, dest+"?utm_medium=mail&utm_campaign=summer&utm_source=shortener", expand(t, vals))
+	})
+
+	t.Run("link opts out", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{}
+		vals.Set("url", dest)
+		vals.Set("utm_disabled", "true")
+
+		assert.Equal(t, dest, expand(t, vals))
+	})
+}
+
+func TestAPIConfig_interstitial(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}.Router()
+
+	store := shortener.New(postgresDB)
+	domain := uuid.NewString() + ".example"
+	err := store.SaveDomain(context.Background(), shortener.Domain{Name: domain})
+	require.NoError(t, err)
+	err = store.SetDomainInterstitial(context.Background(), domain, shortener.Interstitial{
+		Enabled: true,
+		Delay:   3,
+		Trusted: []string{"testurl.com"},
+	})
+	require.NoError(t, err)
+
+	shorten := func(t *testing.T, vals url.Values) string {
+		vals.Set("domain", domain)
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+
+		return got.Code
+	}
+	open := func(code string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://"+domain+"/"+code, nil)
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w
+	}
+
+	t.Run("external destination", func(t *testing.T) {
+		t.Parallel()
+
+		dest := "https://www.example.com/" + uuid.NewString()
+		code := shorten(t, url.Values{"url": {dest}})
+
+		w := open(code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `href="`+dest+`"`)
+		assert.Contains(t, w.Body.String(), "Continue to www.example.com")
+		assert.Contains(t, w.Body.String(), "animation-delay: 3s")
+
+		r := httptest.NewRequest(http.MethodGet, "http://"+domain+"/"+code, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got struct {
+			URL     string `json:"url"`
+			Warning string `json:"warning"`
+		}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		require.NoError(t, err)
+		assert.Equal(t, dest, got.URL)
+		assert.Equal(t, shortener.WarningExternal, got.Warning)
+	})
+
+	t.Run("trusted destination", func(t *testing.T) {
+		t.Parallel()
+
+		dest := "https://www.testurl.com/" + uuid.NewString()
+		w := open(shorten(t, url.Values{"url": {dest}}))
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, dest, w.Header().Get("Location"))
+	})
+
+	t.Run("link never warns", func(t *testing.T) {
+		t.Parallel()
+
+		dest := "https://www.example.com/" + uuid.NewString()
+		w := open(shorten(t, url.Values{"url": {dest}, "warn": {"never"}}))
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, dest, w.Header().Get("Location"))
+	})
+
+	t.Run("flagged link", func(t *testing.T) {
+		t.Parallel()
+
+		code := shorten(t, url.Values{"url": {"https://www.testurl.com/" + uuid.NewString()}, "warn": {"never"}})
+		d, err := store.Domain(context.Background(), domain)
+		require.NoError(t, err)
+		err = store.SetFlagged(context.Background(), d, code, true)
+		require.NoError(t, err)
+
+		w := open(code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "This link may be unsafe")
+	})
+
+	t.Run("unknown warn", func(t *testing.T) {
+		t.Parallel()
+
+		vals := url.Values{"url": {"https://www.testurl.com/"}, "warn": {"sometimes"}}
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAPIConfig_metrics(t *testing.T) {
+	t.Parallel()
+	mtr := metrics.New(nil)
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		Metrics: mtr,
+	}.Router()
+
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader("url=http"))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The requests no route matches are counted too.
+	for _, r := range []*http.Request{httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRequest(http.MethodDelete, "/abc", nil)} {
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w = httptest.NewRecorder()
+	mtr.Handler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `shortener_http_requests_total{method="POST",route="/shorten",status="400"} 1`)
+	assert.Contains(t, body, `shortener_http_request_duration_seconds_count{method="POST",route="/shorten",status="400"} 1`)
+	assert.Contains(t, body, `shortener_link_operations_total{operation="shorten",outcome="invalid"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="DELETE",route="unmatched",status="405"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestDebugMux(t *testing.T) {
+	t.Parallel()
+	mux := handlers.DebugMux(stdLgr, "--db-password=xxxxxx", metrics.New(nil))
+
+	tests := []struct {
+		path string
+		exp  string
+	}{
+		{"/debug/config", "--db-password=xxxxxx"},
+		{"/debug/vars", `"memstats"`},
+		{"/debug/pprof/", "goroutine"},
+		{"/metrics", "go_goroutines"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), tt.exp)
+		})
+	}
+}
+
+func TestAPIConfig_middleware(t *testing.T) {
+	t.Parallel()
+
+	newRouter := func(db *sqlx.DB) (http.Handler, *observer.ObservedLogs) {
+		core, logs := observer.New(zap.InfoLevel)
+		return handlers.APIConfig{
+			Log: zap.New(core).Sugar(),
+			DB:  db,
+		}.Router(), logs
+	}
+
+	t.Run("request ID is propagated", func(t *testing.T) {
+		t.Parallel()
+		router, logs := newRouter(postgresDB)
+
+		r := httptest.NewRequest(http.MethodGet, "/liveness", nil)
+		r.Header.Set("X-Request-ID", "abc-123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "abc-123", w.Header().Get("X-Request-ID"))
+
+		entries := logs.FilterMessage("request").All()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "abc-123", fields["requestid"])
+		assert.EqualValues(t, http.StatusOK, fields["statusCode"])
+		assert.EqualValues(t, w.Body.Len(), fields["bytes"])
+		assert.Contains(t, fields, "latency")
+	})
+
+	t.Run("client IP behind trusted proxies", func(t *testing.T) {
+		t.Parallel()
+
+		_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+		require.NoError(t, err)
+		core, logs := observer.New(zap.InfoLevel)
+		router := handlers.APIConfig{
+			Log:            zap.New(core).Sugar(),
+			DB:             postgresDB,
+			TrustedProxies: []*net.IPNet{proxies},
+		}.Router()
+
+		tests := []struct {
+			remoteAddr string
+			forwarded  string
+			exp        string
+		}{
+			{"10.0.0.1:1234", "", "10.0.0.1"},
+			{"10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+			{"10.0.0.1:1234", "203.0.113.9, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+			{"192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/liveness", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), r)
+
+			entries := logs.TakeAll()
+			require.Len(t, entries, 1)
+			assert.Equal(t, tt.exp, entries[0].ContextMap()["clientip"], tt.forwarded)
+		}
+	})
+
+	t.Run("request ID is assigned", func(t *testing.T) {
+		t.Parallel()
+		router, _ := newRouter(postgresDB)
+
+		for _, id := range []string{"", "forged\nline"} {
+			r := httptest.NewRequest(http.MethodGet, "/liveness", nil)
+			r.Header.Set("X-Request-ID", id)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			_, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("panic is recovered", func(t *testing.T) {
+		t.Parallel()
+		// The handlers panic on the nil database.
+		router, logs := newRouter(nil)
+
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader("url=https://www.testurl.com/"))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var got struct {
+			Code      string `json:"code"`
+			RequestID string `json:"request_id"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, "internal_error", got.Code)
+		assert.Equal(t, w.Header().Get("X-Request-ID"), got.RequestID)
+
+		entries := logs.FilterMessage("panic").All()
+		require.Len(t, entries, 1)
+		assert.Contains(t, entries[0].ContextMap()["stack"], "runtime/debug.Stack")
+
+		entries = logs.FilterMessage("request").All()
+		require.Len(t, entries, 1)
+		assert.EqualValues(t, http.StatusInternalServerError, entries[0].ContextMap()["statusCode"])
+	})
+}
+
+func TestAPIConfig_tracing(t *testing.T) {
+	t.Parallel()
+
+	// traceSpans returns the names of the ended spans of the trace by their span IDs.
+	traceSpans := func(traceID string) map[string]sdktrace.ReadOnlySpan {
+		found := map[string]sdktrace.ReadOnlySpan{}
+		for _, s := range spans.Ended() {
+			if s.SpanContext().TraceID().String() == traceID {
+				found[s.SpanContext().SpanID().String()] = s
+			}
+		}
+		return found
+	}
+	traceparent := func() (string, string, string) {
+		traceID := strings.ReplaceAll(uuid.NewString(), "-", "")
+		spanID := traceID[:16]
+		return "00-" + traceID + "-" + spanID + "-01", traceID, spanID
+	}
+
+	t.Run("request span continues the caller's trace", func(t *testing.T) {
+		t.Parallel()
+		core, logs := observer.New(zap.InfoLevel)
+		router := handlers.APIConfig{
+			Log: zap.New(core).Sugar(),
+			DB:  postgresDB,
+		}.Router()
+
+		header, traceID, parentID := traceparent()
+		r := httptest.NewRequest(http.MethodGet, "/liveness", nil)
+		r.Header.Set("traceparent", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		found := traceSpans(traceID)
+		require.Len(t, found, 1)
+		for _, s := range found {
+			assert.Equal(t, "GET /liveness", s.Name())
+			assert.Equal(t, parentID, s.Parent().SpanID().String())
+		}
+
+		entries := logs.FilterMessage("request").All()
+		require.Len(t, entries, 1)
+		assert.Equal(t, traceID, entries[0].ContextMap()["traceid"])
+	})
+
+	t.Run("engine and database spans", func(t *testing.T) {
+		t.Parallel()
+		router := handlers.APIConfig{
+			Log: stdLgr,
+			DB:  postgresDB,
+		}.Router()
+
+		header, traceID, _ := traceparent()
+		vals := url.Values{"url": {"https://www.testurl.com/" + uuid.NewString()}}
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("traceparent", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		names := map[string]string{}
+		found := traceSpans(traceID)
+		for _, s := range found {
+			names[s.Name()] = s.Parent().SpanID().String()
+		}
+
+		require.Contains(t, names, "POST /shorten")
+		require.Contains(t, names, "shortener.Shorten")
+		assert.Equal(t, "POST /shorten", found[names["shortener.Shorten"]].Name())
+
+		var statements int
+		for _, s := range found {
+			if s.Parent().SpanID() == found[names["shortener.Shorten"]].SpanContext().SpanID() {
+				statements++
+			}
+		}
+		assert.Greater(t, statements, 0, "the SQL statements are traced under the engine's span")
+	})
+}
+
+func TestAPIConfig_problems(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}
+
+	type problem struct {
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Status    int    `json:"status"`
+		Code      string `json:"code"`
+		Detail    string `json:"detail"`
+		RequestID string `json:"request_id"`
+	}
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) problem {
+		t.Helper()
+
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var got problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, w.Code, got.Status)
+		return got
+	}
+
+	t.Run("problem details of a validation error", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader("url=hjef"))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Request-ID", "problem-1")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		got := decode(t, w)
+		assert.Equal(t, "https://github.com/illyasch/url-shortener/blob/master/docs/problems.md#invalid_request", got.Type)
+		assert.Equal(t, "Bad Request", got.Title)
+		assert.Equal(t, "invalid_request", got.Code)
+		assert.NotEmpty(t, got.Detail)
+		assert.Equal(t, "problem-1", got.RequestID)
+	})
+
+	t.Run("codes of the link errors", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			path   string
+			status int
+			code   string
+		}{
+			{"/abc", http.StatusBadRequest, "invalid_code"},
+			{"/abc_def!", http.StatusBadRequest, "invalid_code"},
+			{"/000001", http.StatusBadRequest, "code_out_of_range"},
+			{"/api/v1/links/000001/stats", http.StatusBadRequest, "code_out_of_range"},
+			{"/api/v1/links?order=up", http.StatusBadRequest, "invalid_request"},
+		}
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w := httptest.NewRecorder()
+
+			cfg.Router().ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code, tt.path)
+			got := decode(t, w)
+			assert.Equal(t, tt.code, got.Code, tt.path)
+		}
+	})
+
+}
+
+func TestAPIConfig_v1(t *testing.T) {
+	t.Parallel()
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := handlers.APIConfig{
+		Log:    stdLgr,
+		DB:     postgresDB,
+		Sunset: sunset,
+	}
+
+	t.Run("JSON body is shortened", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/json/" + uuid.NewString()
+		body := `{"url": "` + expURL + `", "owner": "json", "tags": ["a", "b"], "max_clicks": 3}`
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body))
+		r.Header.Add("Content-Type", "application/json; charset=utf-8")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Deprecation"))
+		var got struct {
+			Code string `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.NotEmpty(t, got.Code)
+
+		var link struct {
+			Owner      string `db:"owner"`
+			ClicksLeft int64  `db:"clicks_left"`
+		}
+		err := postgresDB.Get(&link, "SELECT owner, clicks_left FROM urls WHERE url = $1", expURL)
+		require.NoError(t, err)
+		assert.Equal(t, "json", link.Owner)
+		assert.EqualValues(t, 3, link.ClicksLeft)
+	})
+
+	t.Run("JSON body is decoded strictly", func(t *testing.T) {
+		t.Parallel()
+
+		for _, body := range []string{
+			`{"url": "https://www.testurl.com/", "color": "red"}`,
+			`{"url": "https://www.testurl.com/"} {}`,
+			`{"url": "https://www.testurl.com/", "max_clicks": "3"}`,
+			`{"url": "https://www.testurl.com/", "owner": "` + strings.Repeat("a", 20<<10) + `"}`,
+		} {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body))
+			r.Header.Add("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			cfg.Router().ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var got struct {
+				Code string `json:"code"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, "invalid_request", got.Code)
+		}
+	})
+
+	t.Run("unversioned route is deprecated", func(t *testing.T) {
+		t.Parallel()
+		cfg := cfg
+		cfg.PathPrefix = "/s"
+
+		r := httptest.NewRequest(http.MethodPost, "/s/shorten", strings.NewReader("url=hjef"))
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+		assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+		assert.Equal(t, `</s/api/v1/shorten>; rel="successor-version"`, w.Header().Get("Link"))
+	})
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}.Router()
+	ctx := context.Background()
+
+	// The document is taken from the service, so the served one is checked too.
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(ctx))
+	specRouter, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	// check sends the request to the service and fails the test when the response
+	// is not described by the spec. It records the operations the test covers.
+	covered := map[string]bool{}
+	check := func(t *testing.T, r *http.Request, status int) *httptest.ResponseRecorder {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, status, w.Code, "%s %s: %s", r.Method, r.URL, w.Body)
+
+		route, params, err := specRouter.FindRoute(r)
+		require.NoError(t, err, "%s %s is not in the spec", r.Method, r.URL)
+		err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: params,
+				Route:      route,
+			},
+			Status:  w.Code,
+			Header:  w.Header(),
+			Body:    io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+			Options: &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		require.NoError(t, err, "%s %s", r.Method, r.URL)
+
+		covered[route.Operation.OperationID] = true
+		return w
+	}
+	get := func(target string, header ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		return r
+	}
+	post := func(target, contentType, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+	put := func(target, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		return r
+	}
+	const form = "application/x-www-form-urlencoded"
+	shorten := func(t *testing.T, body string) string {
+		t.Helper()
+
+		w := check(t, post("/api/v1/shorten", "application/json", body), http.StatusOK)
+		var got struct {
+			Code string `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		return got.Code
+	}
+
+	t.Run("service", func(t *testing.T) {
+		check(t, get("/liveness"), http.StatusOK)
+		check(t, get("/api/v1/openapi.json"), http.StatusOK)
+		check(t, get("/api/v1/docs"), http.StatusOK)
+		check(t, get("/readiness"), http.StatusOK)
+	})
+
+	t.Run("validation problems", func(t *testing.T) {
+		check(t, post("/api/v1/shorten", "application/json", `{"url": 1}`), http.StatusBadRequest)
+		check(t, post("/shorten", form, "url=hjef"), http.StatusBadRequest)
+		check(t, post("/api/v1/shorten/batch", "application/json", `{"links": {}}`), http.StatusBadRequest)
+		check(t, get("/api/v1/links?limit=1000", "Authorization", "Bearer "+apiKey), http.StatusBadRequest)
+		check(t, get("/api/v1/links?limit=1"), http.StatusUnauthorized)
+		check(t, get("/000001"), http.StatusBadRequest)
+		check(t, get("/000001/qr?size=1"), http.StatusBadRequest)
+	})
+
+	t.Run("links", func(t *testing.T) {
+		owner := uuid.NewString()
+		code := shorten(t, `{"url": "https://www.testurl.com/openapi", "owner": "`+owner+`", "tags": ["spec"], "passthrough": true}`)
+
+		w := check(t, post("/shorten", form, "url=https://www.testurl.com/openapi&owner="+owner), http.StatusOK)
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+
+		check(t, get("/api/v1/links?owner="+owner+"&limit=1", "Authorization", "Bearer "+apiKey), http.StatusOK)
+		check(t, get("/"+code), http.StatusOK)
+		check(t, get("/"+code, "Accept", "text/html"), http.StatusFound)
+		check(t, post("/"+code, form, "password="), http.StatusOK)
+		check(t, get("/"+code+"/docs"), http.StatusOK)
+		check(t, post("/"+code+"/docs", form, "password="), http.StatusOK)
+		check(t, get("/"+code+"+"), http.StatusOK)
+		check(t, get("/"+code+"/qr"), http.StatusOK)
+		w = check(t, get("/"+code+"/qr?format=svg"), http.StatusOK)
+		check(t, get("/"+code+"/qr?format=svg", "If-None-Match", w.Header().Get("ETag")), http.StatusNotModified)
+
+		check(t, put("/api/v1/links/"+code+"/rules", `{"rules": [{"platform": "ios", "url": "https://apps.apple.com/"}]}`), http.StatusOK)
+		check(t, put("/api/v1/links/"+code+"/rules", `{"rules": [{"platform": "tv", "url": "https://apps.apple.com/"}]}`), http.StatusBadRequest)
+		check(t, get("/api/v1/links/"+code+"/rules"), http.StatusOK)
+		unauthorized := put("/api/v1/links/"+code+"/rules", `{"rules": []}`)
+		unauthorized.Header.Del("Authorization")
+		check(t, unauthorized, http.StatusUnauthorized)
+		unauthorized = put("/api/v1/links/"+code+"/variants", `{"variants": []}`)
+		unauthorized.Header.Del("Authorization")
+		check(t, unauthorized, http.StatusUnauthorized)
+		check(t, put("/api/v1/links/"+code+"/variants", `{"sticky": false, "variants": [{"name": "a", "url": "https://www.testurl.com/a", "weight": 1}]}`), http.StatusOK)
+		check(t, get("/api/v1/links/"+code+"/variants"), http.StatusOK)
+		check(t, get("/api/v1/links/"+code+"/stats"), http.StatusOK)
+		check(t, get("/api/v1/links/"+code), http.StatusOK)
+
+		check(t, post("/api/v1/shorten/batch", "application/json",
+			`{"links": [{"url": "https://www.testurl.com/batch"}, {"url": "hjef"}]}`), http.StatusOK)
+
+		code = shorten(t, `{"url": "https://www.testurl.com/deleted/`+uuid.NewString()+`"}`)
+		check(t, httptest.NewRequest(http.MethodDelete, "/api/v1/links/"+code, nil), http.StatusUnauthorized)
+		del := httptest.NewRequest(http.MethodDelete, "/api/v1/links/"+code, nil)
+		del.Header.Set("Authorization", "Bearer "+apiKey)
+		check(t, del, http.StatusNoContent)
+		del = httptest.NewRequest(http.MethodDelete, "/api/v1/links/"+code, nil)
+		del.Header.Set("Authorization", "Bearer "+apiKey)
+		check(t, del, http.StatusNotFound)
+		check(t, get("/api/v1/links/"+code), http.StatusNotFound)
+	})
+
+	t.Run("link problems", func(t *testing.T) {
+		var id int64
+		err := postgresDB.Get(&id, "SELECT COALESCE(MAX(code_id), 0) FROM urls")
+		require.NoError(t, err)
+		missing := shortener.Encode(id + shortener.EncShift*100)
+		check(t, get("/"+missing), http.StatusNotFound)
+		check(t, get("/"+missing, "Accept", "text/html"), http.StatusNotFound)
+		check(t, get("/"+missing+"+"), http.StatusNotFound)
+		check(t, get("/api/v1/links/"+missing+"/stats"), http.StatusNotFound)
+
+		code := shorten(t, `{"url": "https://www.testurl.com/closed/`+uuid.NewString()+`", "max_clicks": 1}`)
+		check(t, get("/"+code), http.StatusOK)
+		check(t, get("/"+code), http.StatusGone)
+		check(t, get("/"+code+"/qr"), http.StatusGone)
+
+		code = shorten(t, `{"url": "https://www.testurl.com/fixed/`+uuid.NewString()+`"}`)
+		check(t, get("/"+code+"/more"), http.StatusNotFound)
+		check(t, put("/api/v1/links/"+code+"/rules", `{"rules": []}`), http.StatusConflict)
+		check(t, put("/api/v1/links/"+code+"/variants", `{"variants": []}`), http.StatusConflict)
+
+		code = shorten(t, `{"url": "https://www.testurl.com/secret/`+uuid.NewString()+`", "password": "secret"}`)
+		check(t, get("/"+code), http.StatusUnauthorized)
+		check(t, get("/"+code+"+"), http.StatusUnauthorized)
+		for i := 0; i < shortener.MaxPasswordAttempts; i++ {
+			check(t, get("/"+code, "X-Link-Password", "wrong"), http.StatusUnauthorized)
+		}
+		check(t, get("/"+code, "X-Link-Password", "wrong"), http.StatusTooManyRequests)
+	})
+
+	for _, item := range doc.Paths {
+		for method, op := range item.Operations() {
+			assert.True(t, covered[op.OperationID], "%s %s is not checked", method, op.OperationID)
+		}
+	}
+}
+
+func TestAPIConfig_linkManagement(t *testing.T) {
+	t.Parallel()
+	router := handlers.APIConfig{
+		Log:     stdLgr,
+		DB:      postgresDB,
+		APIKeys: []string{apiKey},
+	}.Router()
+
+	shortenJSON := func(t *testing.T, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/batch/" + uuid.NewString()
+		w := shortenJSON(t, "/api/v1/shorten/batch", `{"links": [{"url": "`+expURL+`", "owner": "batch"}, {"url": "hjef"}]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var got struct {
+			Results []struct {
+				Code  string `json:"code"`
+				Error *struct {
+					Status int    `json:"status"`
+					Code   string `json:"code"`
+				} `json:"error"`
+			} `json:"results"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		require.Len(t, got.Results, 2)
+
+		var id int64
+		err := postgresDB.Get(&id, "SELECT code_id FROM urls WHERE url = $1", expURL)
+		require.NoError(t, err)
+		assert.Equal(t, shortener.Encode(id), got.Results[0].Code)
+		assert.Nil(t, got.Results[0].Error)
+
+		require.NotNil(t, got.Results[1].Error)
+		assert.Equal(t, http.StatusBadRequest, got.Results[1].Error.Status)
+		assert.Equal(t, "invalid_request", got.Results[1].Error.Code)
+	})
+
+	t.Run("batch too large", func(t *testing.T) {
+		t.Parallel()
+
+		links := strings.Repeat(`{"url": "https://www.testurl.com/"},`, 101)
+		w := shortenJSON(t, "/api/v1/shorten/batch", `{"links": [`+strings.TrimSuffix(links, ",")+`]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("get and delete", func(t *testing.T) {
+		t.Parallel()
+
+		expURL := "https://www.testurl.com/manage/" + uuid.NewString()
+		w := shortenJSON(t, "/api/v1/shorten", `{"url": "`+expURL+`", "tags": ["manage"]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var link struct {
+			Code string `json:"code"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/links/"+link.Code, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		var got struct {
+			URL    string   `json:"url"`
+			Tags   []string `json:"tags"`
+			Clicks int64    `json:"clicks"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+		assert.Equal(t, expURL, got.URL)
+		assert.Equal(t, []string{"manage"}, got.Tags)
+		assert.Zero(t, got.Clicks)
+
+		r = httptest.NewRequest(http.MethodDelete, "/api/v1/links/"+link.Code, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		r = httptest.NewRequest(http.MethodDelete, "/api/v1/links/"+link.Code, nil)
+		r.Header.Set("Authorization", "Bearer "+apiKey)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			r = httptest.NewRequest(method, "/api/v1/links/"+link.Code, nil)
+			r.Header.Set("Authorization", "Bearer "+apiKey)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusNotFound, w.Code, method)
+		}
+
+		r = httptest.NewRequest(http.MethodGet, "/"+link.Code, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestLoadPages(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "expired.html"), []byte("expired everywhere"), 0o600)
+	require.NoError(t, err)
+	err = os.Mkdir(filepath.Join(dir, "go.example"), 0o700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "go.example", "not_found.html"), []byte("branded {{.Code}}"), 0o600)
+	require.NoError(t, err)
+
+	pages, err := handlers.LoadPages(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		domain string
+		page   string
+		exp    string
+	}{
+		{"domain override", "go.example", "not_found.html", "branded udXWFB"},
+		{"global override", "go.example", "expired.html", "expired everywhere"},
+		{"embedded template", "ex.ample", "not_found.html", "Link not found"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			err := pages.Render(w, http.StatusNotFound, tt.domain, tt.page, struct{ Title, Domain, Code, ShortURL, HomeURL string }{
+				Code: "udXWFB",
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), tt.exp)
+		})
+	}
+}
+
+func TestAPIConfig_handleQRCode(t *testing.T) {
+	t.Parallel()
+	cfg := handlers.APIConfig{
+		Log: stdLgr,
+		DB:  postgresDB,
+	}
+
+	vals := url.Values{}
+	vals.Set("url", "https://www.testurl.com/qr/"+uuid.NewString())
+	r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(vals.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	cfg.Router().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var link struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&link)
+	require.NoError(t, err)
+
+	t.Run("PNG image cached with an ETag", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/"+link.Code+"/qr?size=128&ecc=H&fg=0b62d6", nil)
+		w := httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		r = httptest.NewRequest(http.MethodGet, "/"+link.Code+"/qr?size=128&ecc=H&fg=0b62d6", nil)
+		r.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+	})
+
+	t.Run("SVG image", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/"+link.Code+"/qr?format=svg&margin=0", nil)
+		w := httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), "<svg "))
+	})
+
+	t.Run("options validation error", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet, "/"+link.Code+"/qr?size=1", nil)
+		w := httptest.NewRecorder()
+		cfg.Router().ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+const (
+	listDefaultLimit = 20
+	listMaxLimit     = 100
+)
+
+type linkResponse struct {
+	Code          string     `json:"code"`
+	Domain        string     `json:"domain"`
+	ShortURL      string     `json:"short_url"`
+	URL           string     `json:"url,omitempty"`
+	Owner         string     `json:"owner,omitempty"`
+	Tags          []string   `json:"tags"`
+	Clicks        int64      `json:"clicks"`
+	ClicksLeft    *int64     `json:"clicks_left,omitempty"`
+	Protected     bool       `json:"protected"`
+	Passthrough   bool       `json:"passthrough"`
+	QueryConflict string     `json:"query_conflict,omitempty"`
+	UTMSource     string     `json:"utm_source,omitempty"`
+	UTMMedium     string     `json:"utm_medium,omitempty"`
+	UTMCampaign   string     `json:"utm_campaign,omitempty"`
+	UTMDisabled   bool       `json:"utm_disabled"`
+	Warn          string     `json:"warn,omitempty"`
+	Flagged       bool       `json:"flagged"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	SoonURL       string     `json:"soon_url,omitempty"`
+	EndedURL      string     `json:"ended_url,omitempty"`
+	DateCreated   time.Time  `json:"date_created"`
+}
+
+// handleListLinks handler returns a page of links matching the query filters.
+// Pages are chained with the opaque next_cursor token.
+func (cfg APIConfig) handleListLinks(store shortener.Engine) http.HandlerFunc {
+	type listResponse struct {
+		Links      []linkResponse `json:"links"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r)
+		if err != nil {
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("list links", "ERROR", fmt.Errorf("validation query(%s): %w", r.URL.RawQuery, err))
+			return
+		}
+
+		// Fetch one extra link to find out whether there is a next page.
+		limit := filter.Limit
+		filter.Limit++
+
+		links, err := store.List(r.Context(), filter)
+		if err != nil {
+			cfg.fail(w, err)
+			cfg.log(r).Errorw("list links", "ERROR", fmt.Errorf("listing: %w", err))
+			return
+		}
+
+		var resp listResponse
+		if len(links) > limit {
+			links = links[:limit]
+			resp.NextCursor = encodeCursor(links[limit-1].ID)
+		}
+
+		resp.Links = make([]linkResponse, 0, len(links))
+		for _, l := range links {
+			resp.Links = append(resp.Links, cfg.linkResponse(r, l))
+		}
+
+		cfg.respond(w, http.StatusOK, resp)
+	}
+}
+
+// handleGetLink handler returns the link without counting a click. The link is looked up
+// in the domain named by the domain query parameter or in the domain of the request's host.
+func (cfg APIConfig) handleGetLink(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "get link", err)
+			return
+		}
+
+		link, err := store.Link(r.Context(), domain, mux.Vars(r)["code"])
+		if err != nil {
+			cfg.apiFailure(w, r, "get link", err)
+			return
+		}
+
+		cfg.respond(w, http.StatusOK, cfg.linkResponse(r, link))
+	}
+}
+
+// handleDeleteLink handler removes the link with its clicks. The codes of the removed links are never issued again.
+func (cfg APIConfig) handleDeleteLink(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "delete link", err)
+			return
+		}
+
+		if err := store.Delete(r.Context(), domain, mux.Vars(r)["code"]); err != nil {
+			cfg.apiFailure(w, r, "delete link", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// linkResponse converts the link to its response. The destinations of the links
+// protected by a password are left out.
+func (cfg APIConfig) linkResponse(r *http.Request, l shortener.Link) linkResponse {
+	l = l.Redacted()
+	return linkResponse{
+		Code:          l.Code(),
+		Domain:        l.Domain,
+		ShortURL:      cfg.shortURL(r, l.Domain, l.Code()),
+		URL:           l.URL,
+		Owner:         l.Owner,
+		Tags:          l.Tags,
+		Clicks:        l.Clicks,
+		ClicksLeft:    l.ClicksLeft,
+		Protected:     l.Protected(),
+		Passthrough:   l.Passthrough.Enabled,
+		QueryConflict: l.QueryConflict,
+		UTMSource:     l.UTM.Source,
+		UTMMedium:     l.UTM.Medium,
+		UTMCampaign:   l.UTM.Campaign,
+		UTMDisabled:   l.UTMDisabled,
+		Warn:          string(l.Warn),
+		Flagged:       l.Flagged,
+		NotBefore:     l.NotBefore,
+		NotAfter:      l.NotAfter,
+		SoonURL:       l.SoonURL,
+		EndedURL:      l.EndedURL,
+		DateCreated:   l.DateCreated,
+	}
+}
+
+// apiFailure responds to the link API request with the problem of an error finding the link or its domain.
+func (cfg APIConfig) apiFailure(w http.ResponseWriter, r *http.Request, name string, err error) {
+	cfg.fail(w, err)
+	cfg.log(r).Errorw(name, "ERROR", fmt.Errorf("code(%s): %w", mux.Vars(r)["code"], err))
+}
+
+// parseFilter reads the list filters from the query string.
+func parseFilter(r *http.Request) (shortener.Filter, error) {
+	q := r.URL.Query()
+	f := shortener.Filter{
+		Owner:  q.Get("owner"),
+		Domain: q.Get("branded_domain"),
+		Host:   q.Get("domain"),
+		Tag:    q.Get("tag"),
+		Search: q.Get("q"),
+		Limit:  listDefaultLimit,
+	}
+
+	// host is the name domain had for a while after the links got branded domains.
+	if f.Host == "" {
+		f.Host = q.Get("host")
+	}
+
+	var err error
+	if v := q.Get("created_after"); v != "" {
+		if f.CreatedAfter, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_after must be an RFC 3339 timestamp")
+		}
+	}
+	if v := q.Get("created_before"); v != "" {
+		if f.CreatedBefore, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("created_before must be an RFC 3339 timestamp")
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		f.Limit, err = strconv.Atoi(v)
+		if err != nil || f.Limit < 1 || f.Limit > listMaxLimit {
+			return f, fmt.Errorf("limit must be between 1 and %d", listMaxLimit)
+		}
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+		f.Desc = true
+	case "asc":
+	default:
+		return f, errors.New("order must be asc or desc")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if f.AfterID, err = decodeCursor(v); err != nil {
+			return f, errors.New("cursor is incorrect")
+		}
+	}
+
+	return f, nil
+}
+
+// encodeCursor makes an opaque pagination token from a link id.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the link id stored in a pagination token.
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("cursor id is out of range")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// Outcomes of shortening and expanding the links counted in the metrics.
+const (
+	outcomeOK       = "ok"
+	outcomeInvalid  = "invalid"
+	outcomeDecode   = "decode_error"
+	outcomeNotFound = "not_found"
+	outcomeRefused  = "refused"
+	outcomeDBError  = "db_error"
+)
+
+// routeUnmatched is the route label of the requests no route matches, e.g. of
+// the unknown paths answered with 404 and the wrong methods answered with 405.
+const routeUnmatched = "unmatched"
+
+// observe records every request in the metrics, the requests no route matches under
+// routeUnmatched. It wraps the whole router, as the middleware of the router only runs
+// for the matched routes; the route is filled in by nameRoute once it is matched.
+// The cache hit rate and the analytics queue depth are not observed: the links are
+// read from the database on every visit and the clicks are recorded in the statement
+// opening the link, so the service has neither a cache nor a queue.
+func (cfg APIConfig) observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+
+		route := routeUnmatched
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeKey, &route)))
+
+		cfg.Metrics.ObserveRequest(route, r.Method, rec.statusCode, time.Since(start))
+	})
+}
+
+// nameRoute names the span of the request after the matched route and tells observe
+// the route. The routes are labeled with their path templates, so the codes do not
+// make a label of their own.
+func (cfg APIConfig) nameRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				if route, ok := r.Context().Value(routeKey).(*string); ok {
+					*route = tpl
+				}
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + tpl)
+				span.SetAttributes(semconv.HTTPRouteKey.String(tpl))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// outcome classifies the error of shortening or expanding a link for the metrics.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeOK
+	case errors.Is(err, shortener.DecodeErr), errors.Is(err, shortener.TemplateErr):
+		return outcomeDecode
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, shortener.PassthroughErr):
+		return outcomeNotFound
+	case errors.Is(err, shortener.ForbiddenErr):
+		return outcomeRefused
+	}
+
+	if status, _ := linkFailure(err); status != http.StatusInternalServerError {
+		return outcomeRefused
+	}
+
+	return outcomeDBError
+}
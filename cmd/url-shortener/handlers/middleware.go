@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/illyasch/url-shortener/pkg/sys/tracing"
+)
+
+// requestIDHeader is the header the request IDs are taken from and returned in.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDFormat is the format of the request IDs taken from the clients, the
+// other IDs are replaced, so they can not forge the log lines.
+var requestIDFormat = regexp.MustCompile(`^[0-9A-Za-z._:-]{1,128}$`)
+
+// ctxKey is the type of the keys of the values the middleware puts in the request context.
+type ctxKey int
+
+const (
+	loggerKey ctxKey = 1
+
+	// routeKey holds the route the request is observed under in the metrics.
+	routeKey ctxKey = 2
+)
+
+// responseRecorder remembers the status code and the number of bytes written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+
+	return &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (w *responseRecorder) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+
+	return n, err
+}
+
+// requestID takes the request ID from the X-Request-ID header or assigns a new one. The ID is
+// returned in the response header and added to every line of the request-scoped logger together
+// with the IDs of the request's trace and span.
+func (cfg APIConfig) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDFormat.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		log := cfg.Log.With("requestid", id)
+		if traceID, spanID := tracing.IDs(r.Context()); traceID != "" {
+			log = log.With("traceid", traceID, "spanid", spanID)
+		}
+
+		ctx := context.WithValue(r.Context(), loggerKey, log)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// accessLog writes a line about every request with its status, size and latency. The client
+// address is the one behind the trusted proxies.
+func (cfg APIConfig) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		cfg.log(r).Infow("request", "statusCode", rec.statusCode, "method", r.Method, "path", r.URL.Path,
+			"remoteaddr", r.RemoteAddr, "clientip", cfg.remoteIP(r).String(), "bytes", rec.bytes, "latency", time.Since(start))
+	})
+}
+
+// recoverPanic turns a panic of a handler into a 500 response and logs it with the stack.
+func (cfg APIConfig) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// The server aborts the response on purpose with http.ErrAbortHandler.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			err := fmt.Errorf("%v", v)
+			cfg.log(r).Errorw("panic", "ERROR", err, "stack", string(debug.Stack()))
+			if !rec.wroteHeader {
+				cfg.fail(rec, err)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// deprecated marks the responses of a route replaced by the successor path with the Deprecation
+// and Sunset headers and links the successor, so the clients find out they have to move.
+func (cfg APIConfig) deprecated(successor string, next http.Handler) http.Handler {
+	link := fmt.Sprintf(`<%s%s>; rel="successor-version"`, strings.TrimSuffix(cfg.PathPrefix, "/"), successor)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if !cfg.Sunset.IsZero() {
+			w.Header().Set("Sunset", cfg.Sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add("Link", link)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize lets the requests bearing one of the API keys through to the next handler,
+// the others are refused with the unauthorized problem.
+func (cfg APIConfig) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			cfg.problem(w, http.StatusUnauthorized, codeUnauthorized, "API key is missing or incorrect")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether the bearer token of the request is one of the API keys.
+// The keys are compared in constant time, so the timing does not give them away.
+func (cfg APIConfig) authorized(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return false
+	}
+
+	for _, key := range cfg.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// log returns the logger of the request, it tells the lines of the request by its ID.
+func (cfg APIConfig) log(r *http.Request) *zap.SugaredLogger {
+	if l, ok := r.Context().Value(loggerKey).(*zap.SugaredLogger); ok {
+		return l
+	}
+
+	return cfg.Log
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+//go:embed openapi
+var openapiFS embed.FS
+
+// spec is the OpenAPI document of the API. It is validated when the service starts.
+var spec = func() *openapi3.T {
+	data, err := openapiFS.ReadFile("openapi/openapi.json")
+	if err != nil {
+		panic(err)
+	}
+
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		panic(fmt.Errorf("load openapi.json: %w", err))
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		panic(fmt.Errorf("validate openapi.json: %w", err))
+	}
+	return doc
+}()
+
+// docsPage renders the OpenAPI document as an HTML page.
+var docsPage = template.Must(template.New("docs.html").Funcs(template.FuncMap{
+	"schema": schemaName,
+}).ParseFS(openapiFS, "openapi/docs.html"))
+
+// schemaName describes the type of a schema on the docs page, e.g. "array of Link".
+func schemaName(s *openapi3.SchemaRef) string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Ref != "":
+		return s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	case s.Value.Type == "array":
+		return "array of " + schemaName(s.Value.Items)
+	case s.Value.Format != "":
+		return s.Value.Type + " (" + s.Value.Format + ")"
+	}
+
+	return s.Value.Type
+}
+
+// specFor returns the OpenAPI document with the server the request is served by, so the
+// clients reach the API on the public base URL and under the path prefix.
+func (cfg APIConfig) specFor(r *http.Request) *openapi3.T {
+	doc := *spec
+	doc.Servers = openapi3.Servers{{URL: cfg.baseURL(r, shortener.DefaultDomain)}}
+	return &doc
+}
+
+// handleOpenAPI handler returns the OpenAPI document of the API.
+func (cfg APIConfig) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := cfg.specFor(r)
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		cfg.fail(w, err)
+		cfg.log(r).Errorw("openapi", "ERROR", fmt.Errorf("json marshal: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		cfg.log(r).Errorw("openapi", "ERROR", fmt.Errorf("write output: %w", err))
+	}
+}
+
+// handleDocs handler renders the OpenAPI document as the HTML documentation of the API.
+func (cfg APIConfig) handleDocs(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := docsPage.Execute(&buf, cfg.specFor(r)); err != nil {
+		cfg.fail(w, err)
+		cfg.log(r).Errorw("docs", "ERROR", fmt.Errorf("render docs.html: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		cfg.log(r).Errorw("docs", "ERROR", fmt.Errorf("write output: %w", err))
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// Names of the HTML pages.
+const (
+	pageNotFound   = "not_found.html"
+	pageExpired    = "expired.html"
+	pageDisabled   = "disabled.html"
+	pageExhausted  = "exhausted.html"
+	pageNotStarted = "not_started.html"
+	pageError      = "error.html"
+	pagePreview    = "preview.html"
+	pagePassword   = "password.html"
+	pageWarning    = "warning.html"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// embeddedPages are the pages used when APIConfig.Pages is not set.
+var embeddedPages = func() *Pages {
+	p, err := LoadPages("")
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
+// Pages renders the HTML pages shown to the visitors of the short links.
+type Pages struct {
+	base    *template.Template
+	domains map[string]*template.Template
+}
+
+// pageData is the data the page templates are executed with.
+type pageData struct {
+	Title    string
+	Domain   string
+	Code     string
+	ShortURL string
+	HomeURL  string
+
+	// Link and QRCode are shown on the preview page.
+	Link   *shortener.Link
+	QRCode template.URL
+
+	// Error explains why the password form is shown again.
+	Error string
+
+	// Destination, DestinationHost, Delay and Flagged are shown on the interstitial page.
+	Destination     string
+	DestinationHost string
+	Delay           int
+	Flagged         bool
+}
+
+// LoadPages parses the page templates embedded into the binary. When dir is
+// not empty, its *.html files replace the embedded templates with the same
+// names, and the *.html files of its subdirectories replace them only for the
+// domain the subdirectory is named after.
+func LoadPages(dir string) (*Pages, error) {
+	base, err := template.ParseFS(templatesFS, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse embedded templates: %w", err)
+	}
+
+	p := Pages{
+		base:    base,
+		domains: map[string]*template.Template{},
+	}
+	if dir == "" {
+		return &p, nil
+	}
+
+	if p.base, err = override(p.base, dir); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read templates dir: %w", err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		t, err := override(p.base, filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		p.domains[strings.ToLower(e.Name())] = t
+	}
+
+	return &p, nil
+}
+
+// override returns a copy of the templates with the *.html files of the dir parsed over them.
+func override(t *template.Template, dir string) (*template.Template, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("list templates in %s: %w", dir, err)
+	}
+
+	t, err = t.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone templates: %w", err)
+	}
+	if len(files) == 0 {
+		return t, nil
+	}
+
+	if t, err = t.ParseFiles(files...); err != nil {
+		return nil, fmt.Errorf("parse templates in %s: %w", dir, err)
+	}
+
+	return t, nil
+}
+
+// Render writes the named page of the domain with the status code.
+func (p *Pages) Render(w http.ResponseWriter, statusCode int, domain string, name string, data any) error {
+	t, ok := p.domains[domain]
+	if !ok {
+		t = p.base
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("execute template %s: %w", name, err)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// problemTypes is the base of the type URIs of the problems, every code is
+// described under its own heading of the document.
+const problemTypes = "https://github.com/illyasch/url-shortener/blob/master/docs/problems.md#"
+
+// The stable codes of the problems. The clients tell the errors by them, so they never change.
+const (
+	codeInvalidRequest    = "invalid_request"
+	codeInvalidCode       = "invalid_code"
+	codeOutOfRange        = "code_out_of_range"
+	codeInvalidParameters = "invalid_parameters"
+	codeNotFound          = "not_found"
+	codeDomainNotFound    = "domain_not_found"
+	codePathNotAllowed    = "path_not_allowed"
+	codeNotStarted        = "link_not_started"
+	codeExpired           = "link_expired"
+	codeDisabled          = "link_disabled"
+	codeExhausted         = "link_exhausted"
+	codePasswordRequired  = "password_required"
+	codePasswordIncorrect = "password_incorrect"
+	codeRateLimited       = "rate_limited"
+	codeForbidden         = "destination_forbidden"
+	codeShared            = "link_shared"
+	codeUnauthorized      = "unauthorized"
+	codeInternal          = "internal_error"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is the RFC 7807 problem details body of the error responses.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// problem responds with the problem of the code. The detail is shown to the clients,
+// so it never carries the internals such as the SQL.
+func (cfg APIConfig) problem(w http.ResponseWriter, statusCode int, code, detail string) {
+	cfg.writeProblem(w, newProblem(w, statusCode, code, detail))
+}
+
+// fail responds with the problem of an error finding or opening a link.
+func (cfg APIConfig) fail(w http.ResponseWriter, err error) {
+	cfg.writeProblem(w, failure(w, err))
+}
+
+// writeProblem responds with the problem.
+func (cfg APIConfig) writeProblem(w http.ResponseWriter, p problem) {
+	cfg.respondAs(w, p.Status, problemContentType, p)
+}
+
+// newProblem builds the problem of the code for the response, it is told by the response's request ID.
+func newProblem(w http.ResponseWriter, statusCode int, code, detail string) problem {
+	return problem{
+		Type:      problemTypes + code,
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Code:      code,
+		Detail:    detail,
+		RequestID: w.Header().Get(requestIDHeader),
+	}
+}
+
+// failure builds the problem of an error finding or opening a link.
+// The unknown errors are internal, their details are only logged.
+func failure(w http.ResponseWriter, err error) problem {
+	status, _ := linkFailure(err)
+	code, detail := linkProblem(err)
+	if status == http.StatusInternalServerError {
+		code, detail = codeInternal, "the server failed to handle the request"
+	}
+
+	return newProblem(w, status, code, detail)
+}
+
+// linkProblem maps an error of finding or opening a link to the code and the detail of its problem.
+func linkProblem(err error) (string, string) {
+	switch {
+	case errors.Is(err, shortener.EncShiftErr):
+		return codeOutOfRange, shortener.EncShiftErr.Error()
+	case errors.Is(err, shortener.DecodeErr):
+		return codeInvalidCode, shortener.DecodeErr.Error()
+	case errors.Is(err, shortener.TemplateErr):
+		return codeInvalidParameters, shortener.TemplateErr.Error()
+	case errors.Is(err, sql.ErrNoRows):
+		return codeNotFound, "link is not found"
+	case errors.Is(err, shortener.PassthroughErr):
+		return codePathNotAllowed, shortener.PassthroughErr.Error()
+	case errors.Is(err, shortener.NotStartedErr):
+		return codeNotStarted, shortener.NotStartedErr.Error()
+	case errors.Is(err, shortener.ExpiredErr):
+		return codeExpired, shortener.ExpiredErr.Error()
+	case errors.Is(err, shortener.DisabledErr):
+		return codeDisabled, shortener.DisabledErr.Error()
+	case errors.Is(err, shortener.ExhaustedErr):
+		return codeExhausted, shortener.ExhaustedErr.Error()
+	case errors.Is(err, shortener.PasswordRequiredErr):
+		return codePasswordRequired, shortener.PasswordRequiredErr.Error()
+	case errors.Is(err, shortener.PasswordErr):
+		return codePasswordIncorrect, shortener.PasswordErr.Error()
+	case errors.Is(err, shortener.RateLimitedErr):
+		return codeRateLimited, shortener.RateLimitedErr.Error()
+	case errors.Is(err, shortener.ForbiddenErr):
+		return codeForbidden, err.Error()
+	case errors.Is(err, shortener.SharedErr):
+		return codeShared, shortener.SharedErr.Error()
+	}
+
+	return codeInternal, ""
+}
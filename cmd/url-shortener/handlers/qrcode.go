@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+	"github.com/illyasch/url-shortener/pkg/sys/qrcode"
+)
+
+const (
+	qrMinSize   = 32
+	qrMaxSize   = 2048
+	qrMaxMargin = 16
+)
+
+// handleQRCode handler renders the QR code of the full short URL as a PNG or SVG image.
+// The images are cached by the clients with ETags.
+func (cfg APIConfig) handleQRCode(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		format, opts, err := parseQROptions(r)
+		if err != nil {
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("qr code", "ERROR", fmt.Errorf("validation query(%s): %w", r.URL.RawQuery, err))
+			return
+		}
+
+		domain, err := store.ResolveDomain(r.Context(), requestHost(r))
+		if err != nil {
+			cfg.fail(w, err)
+			cfg.log(r).Errorw("qr code", "ERROR", fmt.Errorf("finding domain: %w", err))
+			return
+		}
+
+		// The link is looked up with Link and Check instead of Engine.Expand: Expand would count
+		// a click for every rendered image, take the clicks of the limited links, ask for the
+		// password of the protected ones and refuse the links which are not active yet, whose
+		// codes are rendered for printing in advance.
+		link, err := store.Link(r.Context(), domain, code)
+		if err == nil {
+			err = link.Check(time.Now())
+		}
+		if err != nil && !errors.Is(err, shortener.NotStartedErr) {
+			cfg.fail(w, err)
+			cfg.log(r).Errorw("qr code", "ERROR", fmt.Errorf("finding code(%s): %w", code, err))
+			return
+		}
+
+		shortURL := cfg.shortURL(r, domain.Name, code)
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%+v", shortURL, format, opts)))
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		var (
+			image       []byte
+			contentType string
+		)
+		switch format {
+		case "svg":
+			image, err = qrcode.SVG(shortURL, opts)
+			contentType = "image/svg+xml"
+		default:
+			image, err = qrcode.PNG(shortURL, opts)
+			contentType = "image/png"
+		}
+		if err != nil {
+			w.Header().Del("ETag")
+			w.Header().Del("Cache-Control")
+			cfg.fail(w, err)
+			cfg.log(r).Errorw("qr code", "ERROR", fmt.Errorf("rendering code(%s): %w", code, err))
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(image); err != nil {
+			cfg.log(r).Errorw("qr code", "ERROR", fmt.Errorf("write output: %w", err))
+			return
+		}
+	}
+}
+
+// parseQROptions reads the image format and the rendering options from the query string.
+func parseQROptions(r *http.Request) (string, qrcode.Options, error) {
+	q := r.URL.Query()
+	opts := qrcode.DefaultOptions
+
+	format := strings.ToLower(q.Get("format"))
+	switch format {
+	case "":
+		format = "png"
+	case "png", "svg":
+	default:
+		return "", opts, errors.New("format must be png or svg")
+	}
+
+	var err error
+	if v := q.Get("size"); v != "" {
+		opts.Size, err = strconv.Atoi(v)
+		if err != nil || opts.Size < qrMinSize || opts.Size > qrMaxSize {
+			return "", opts, fmt.Errorf("size must be between %d and %d", qrMinSize, qrMaxSize)
+		}
+	}
+	if v := q.Get("margin"); v != "" {
+		opts.Margin, err = strconv.Atoi(v)
+		if err != nil || opts.Margin < 0 || opts.Margin > qrMaxMargin {
+			return "", opts, fmt.Errorf("margin must be between 0 and %d", qrMaxMargin)
+		}
+	}
+	if v := q.Get("ecc"); v != "" {
+		if opts.Level, err = qrcode.ParseLevel(v); err != nil {
+			return "", opts, errors.New("ecc must be L, M, Q or H")
+		}
+	}
+	if v := q.Get("fg"); v != "" {
+		if opts.Foreground, err = qrcode.ParseColor(v); err != nil {
+			return "", opts, fmt.Errorf("fg: %w", err)
+		}
+	}
+	if v := q.Get("bg"); v != "" {
+		if opts.Background, err = qrcode.ParseColor(v); err != nil {
+			return "", opts, fmt.Errorf("bg: %w", err)
+		}
+	}
+
+	return format, opts, nil
+}
+
+// etagMatch reports whether the If-None-Match header matches the ETag.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// rulesMaxBytes limits the size of the rules request body.
+const rulesMaxBytes = 64 << 10
+
+type rulesBody struct {
+	Rules shortener.Rules `json:"rules"`
+}
+
+// handleGetRules handler returns the ordered redirect rules of a link. The link is looked up
+// in the domain named by the domain query parameter or in the domain of the request's host.
+// The URLs of the rules of the links protected by a password are left out.
+func (cfg APIConfig) handleGetRules(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "get rules", err)
+			return
+		}
+
+		link, err := store.Link(r.Context(), domain, code)
+		if err != nil {
+			cfg.apiFailure(w, r, "get rules", err)
+			return
+		}
+
+		rules, err := store.Rules(r.Context(), domain, code)
+		if err != nil {
+			cfg.apiFailure(w, r, "get rules", err)
+			return
+		}
+		if rules == nil {
+			rules = shortener.Rules{}
+		}
+		if link.Protected() {
+			rules = rules.Redacted()
+		}
+
+		cfg.respond(w, http.StatusOK, rulesBody{Rules: rules})
+	}
+}
+
+// handlePutRules handler replaces the redirect rules of a link with the rules of the JSON body.
+// An empty list removes the rules.
+func (cfg APIConfig) handlePutRules(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		var body rulesBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, rulesMaxBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			err = fmt.Errorf("rules body is incorrect: %w", err)
+
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("put rules", "ERROR", fmt.Errorf("validation code(%s): %w", code, err))
+			return
+		}
+
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "put rules", err)
+			return
+		}
+
+		if err := body.Rules.Validate(domain); err != nil {
+			status, problemCode := http.StatusBadRequest, codeInvalidRequest
+			if errors.Is(err, shortener.ForbiddenErr) {
+				status, problemCode = http.StatusForbidden, codeForbidden
+			}
+
+			cfg.problem(w, status, problemCode, err.Error())
+			cfg.log(r).Errorw("put rules", "ERROR", fmt.Errorf("validation code(%s): %w", code, err))
+			return
+		}
+
+		if err := store.SetRules(r.Context(), domain, code, body.Rules); err != nil {
+			cfg.apiFailure(w, r, "put rules", err)
+			return
+		}
+
+		if body.Rules == nil {
+			body.Rules = shortener.Rules{}
+		}
+
+		cfg.respond(w, http.StatusOK, body)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// splitMaxBytes limits the size of the variants request body.
+const splitMaxBytes = 64 << 10
+
+// handleGetSplit handler returns the weighted variants of a link. The link is looked up
+// in the domain named by the domain query parameter or in the domain of the request's host.
+// The URLs of the variants of the links protected by a password are left out.
+func (cfg APIConfig) handleGetSplit(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "get variants", err)
+			return
+		}
+
+		link, err := store.Link(r.Context(), domain, code)
+		if err != nil {
+			cfg.apiFailure(w, r, "get variants", err)
+			return
+		}
+
+		split, err := store.Split(r.Context(), domain, code)
+		if err != nil {
+			cfg.apiFailure(w, r, "get variants", err)
+			return
+		}
+		if link.Protected() {
+			split = split.Redacted()
+		}
+
+		cfg.respond(w, http.StatusOK, split)
+	}
+}
+
+// handlePutSplit handler replaces the weighted variants of a link with the variants of the JSON body.
+// An empty list sends the visitors to the link's URL again.
+func (cfg APIConfig) handlePutSplit(store shortener.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		var split shortener.Split
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, splitMaxBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&split); err != nil {
+			err = fmt.Errorf("variants body is incorrect: %w", err)
+
+			cfg.problem(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			cfg.log(r).Errorw("put variants", "ERROR", fmt.Errorf("validation code(%s): %w", code, err))
+			return
+		}
+
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "put variants", err)
+			return
+		}
+
+		if err := split.Validate(domain); err != nil {
+			status, problemCode := http.StatusBadRequest, codeInvalidRequest
+			if errors.Is(err, shortener.ForbiddenErr) {
+				status, problemCode = http.StatusForbidden, codeForbidden
+			}
+
+			cfg.problem(w, status, problemCode, err.Error())
+			cfg.log(r).Errorw("put variants", "ERROR", fmt.Errorf("validation code(%s): %w", code, err))
+			return
+		}
+
+		if err := store.SetSplit(r.Context(), domain, code, split); err != nil {
+			cfg.apiFailure(w, r, "put variants", err)
+			return
+		}
+
+		if split.Variants == nil {
+			split.Variants = []shortener.Variant{}
+		}
+
+		cfg.respond(w, http.StatusOK, split)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// handleStats handler returns the click statistics of a link. The clicks of a split link
+// are broken down by the variant the visitors were served.
+func (cfg APIConfig) handleStats(store shortener.Engine) http.HandlerFunc {
+	type variantClicks struct {
+		Variant string `json:"variant"`
+		Clicks  int64  `json:"clicks"`
+	}
+	type statsResponse struct {
+		Code     string          `json:"code"`
+		ShortURL string          `json:"short_url"`
+		Clicks   int64           `json:"clicks"`
+		Variants []variantClicks `json:"variants"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := mux.Vars(r)["code"]
+
+		domain, err := selectDomain(r, store)
+		if err != nil {
+			cfg.apiFailure(w, r, "stats", err)
+			return
+		}
+
+		stats, err := store.Stats(r.Context(), domain, code)
+		if err != nil {
+			cfg.apiFailure(w, r, "stats", err)
+			return
+		}
+
+		resp := statsResponse{
+			Code:     code,
+			ShortURL: cfg.shortURL(r, domain.Name, code),
+			Clicks:   stats.Clicks,
+			Variants: make([]variantClicks, 0, len(stats.Variants)),
+		}
+		for _, v := range stats.Variants {
+			resp.Variants = append(resp.Variants, variantClicks{Variant: v.Variant, Clicks: v.Clicks})
+		}
+
+		cfg.respond(w, http.StatusOK, resp)
+	}
+}
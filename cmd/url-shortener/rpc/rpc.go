@@ -0,0 +1,170 @@
+// Package rpc serves the gRPC API of the shortener next to the HTTP one.
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	shortenerv1 "github.com/illyasch/url-shortener/pkg/api/shortener/v1"
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+	"github.com/illyasch/url-shortener/pkg/sys/tracing"
+)
+
+// APIConfig contains all the mandatory systems required by the gRPC services.
+type APIConfig struct {
+	Log *zap.SugaredLogger
+	DB  *sqlx.DB
+
+	// Store is the engine of the links, the one of the HTTP routes, so the password
+	// attempts are limited across both APIs. An engine of DB is constructed when it is nil.
+	Store *shortener.Engine
+
+	// PublicBaseURL is the absolute URL the short links are built on, e.g.
+	// https://sho.rt/s. The calls have no HTTP host to take it from, so the
+	// short URLs are left empty when it is not set.
+	PublicBaseURL string
+
+	// APIKeys are the keys the clients changing the links send as the bearer tokens
+	// of their authorization metadata. The changes are refused to everyone when there
+	// are no keys.
+	APIKeys []string
+}
+
+// authorizedMethods are the methods changing the links, the calls of which need an API key.
+var authorizedMethods = map[string]bool{
+	"/" + shortenerv1.ShortenerService_ServiceDesc.ServiceName + "/DeleteLink": true,
+}
+
+// ctxKey is the type of the keys of the values the interceptors put in the call context.
+type ctxKey int
+
+const loggerKey ctxKey = 1
+
+// Server constructs a gRPC server with the shortener, health and reflection services.
+// Every call is traced and written to the log, the panics of the methods are recovered.
+func (cfg APIConfig) Server() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		otelgrpc.UnaryServerInterceptor(),
+		cfg.accessLog,
+		cfg.recoverPanic,
+		cfg.authorize,
+	))
+
+	store := shortener.New(cfg.DB)
+	if cfg.Store != nil {
+		store = *cfg.Store
+	}
+	shortenerv1.RegisterShortenerServiceServer(srv, &service{cfg: cfg, store: store})
+
+	hs := health.NewServer()
+	hs.SetServingStatus(shortenerv1.ShortenerService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+
+	reflection.Register(srv)
+
+	return srv
+}
+
+// accessLog writes every call to the log with its status code and latency. The lines of
+// the call are told by the IDs of its trace and span.
+func (cfg APIConfig) accessLog(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	log := cfg.Log.With("method", info.FullMethod)
+	if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+		log = log.With("traceid", traceID, "spanid", spanID)
+	}
+
+	resp, err := handler(context.WithValue(ctx, loggerKey, log), req)
+	log.Infow("call", "code", status.Code(err).String(), "latency", time.Since(start))
+
+	return resp, err
+}
+
+// recoverPanic turns a panic of a method into the Internal error and logs it with the stack.
+func (cfg APIConfig) recoverPanic(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		cfg.log(ctx).Errorw("panic", "ERROR", fmt.Errorf("%v", v), "stack", string(debug.Stack()))
+		err = status.Error(codes.Internal, internalMessage)
+	}()
+
+	return handler(ctx, req)
+}
+
+// authorize lets the calls of the methods changing the links through only with one of the
+// API keys, the others are refused with the Unauthenticated error.
+func (cfg APIConfig) authorize(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if authorizedMethods[info.FullMethod] && !cfg.authorized(ctx) {
+		return nil, status.Error(codes.Unauthenticated, "API key is missing or incorrect")
+	}
+
+	return handler(ctx, req)
+}
+
+// authorized reports whether the bearer token of the authorization metadata of the call
+// is one of the API keys. The keys are compared in constant time.
+func (cfg APIConfig) authorized(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(v, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			continue
+		}
+
+		for _, key := range cfg.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// log returns the logger of the call.
+func (cfg APIConfig) log(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(loggerKey).(*zap.SugaredLogger); ok {
+		return l
+	}
+
+	return cfg.Log
+}
+
+// shortURL builds the full short URL of a code in a domain on the public base URL.
+// The branded domains replace its host.
+func (cfg APIConfig) shortURL(domain string, code string) string {
+	if cfg.PublicBaseURL == "" {
+		return ""
+	}
+
+	base := strings.TrimSuffix(cfg.PublicBaseURL, "/")
+	if domain != shortener.DefaultDomain {
+		if u, err := url.Parse(base); err == nil {
+			u.Host = domain
+			base = u.String()
+		}
+	}
+
+	return base + "/" + code
+}
@@ -0,0 +1,266 @@
+package rpc_test
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/illyasch/url-shortener/cmd/url-shortener/rpc"
+	shortenerv1 "github.com/illyasch/url-shortener/pkg/api/shortener/v1"
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+	"github.com/illyasch/url-shortener/pkg/data/database/dbtest"
+	"github.com/illyasch/url-shortener/pkg/sys/logger"
+)
+
+// apiKey is the API key of the servers of the tests changing the links.
+const apiKey = "test-api-key"
+
+var (
+	postgresDB *sqlx.DB
+	stdLgr     *zap.SugaredLogger
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	stdLgr, err = logger.New("shortener")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	postgresDB, err = dbtest.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// dial serves the API on an in-process listener and returns a client connection to it.
+func dial(t *testing.T, cfg rpc.APIConfig) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := cfg.Server()
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestAPIConfig_Server(t *testing.T) {
+	t.Parallel()
+	conn := dial(t, rpc.APIConfig{Log: stdLgr, DB: postgresDB})
+	ctx := context.Background()
+
+	t.Run("health", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+			Service: shortenerv1.ShortenerService_ServiceDesc.ServiceName,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("reflection", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		require.NoError(t, err)
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		require.NoError(t, err)
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+
+		var names []string
+		for _, s := range resp.GetListServicesResponse().GetService() {
+			names = append(names, s.Name)
+		}
+		assert.Contains(t, names, shortenerv1.ShortenerService_ServiceDesc.ServiceName)
+		assert.Contains(t, names, healthpb.Health_ServiceDesc.ServiceName)
+	})
+}
+
+func TestService_validation(t *testing.T) {
+	t.Parallel()
+	client := shortenerv1.NewShortenerServiceClient(dial(t, rpc.APIConfig{Log: stdLgr, DB: postgresDB}))
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name string
+		req  *shortenerv1.ShortenRequest
+	}{
+		{name: "short URL", req: &shortenerv1.ShortenRequest{Url: "hjef"}},
+		{name: "negative max clicks", req: &shortenerv1.ShortenRequest{Url: "https://www.testurl.com/", MaxClicks: -1}},
+		{name: "unknown warning", req: &shortenerv1.ShortenRequest{Url: "https://www.testurl.com/", Warn: "scary"}},
+		{name: "long password", req: &shortenerv1.ShortenRequest{
+			Url:      "https://www.testurl.com/",
+			Password: strings.Repeat("p", shortener.MaxPasswordLen+1),
+		}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := client.Shorten(ctx, tc.req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+
+	t.Run("batch too large", func(t *testing.T) {
+		t.Parallel()
+
+		links := make([]*shortenerv1.ShortenRequest, rpc.MaxBatch+1)
+		for i := range links {
+			links[i] = &shortenerv1.ShortenRequest{Url: "https://www.testurl.com/"}
+		}
+		_, err := client.BatchShorten(ctx, &shortenerv1.BatchShortenRequest{Links: links})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestService(t *testing.T) {
+	t.Parallel()
+	client := shortenerv1.NewShortenerServiceClient(dial(t, rpc.APIConfig{
+		Log:           stdLgr,
+		DB:            postgresDB,
+		PublicBaseURL: "https://sho.rt",
+		APIKeys:       []string{apiKey},
+	}))
+	ctx := context.Background()
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+apiKey)
+
+	expURL := "https://www.testurl.com/grpc/" + uuid.NewString()
+	link, err := client.Shorten(ctx, &shortenerv1.ShortenRequest{Url: expURL, Owner: "alice", Tags: []string{"grpc"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, link.Code)
+	assert.Equal(t, "https://sho.rt/"+link.Code, link.ShortUrl)
+
+	got, err := client.Expand(ctx, &shortenerv1.ExpandRequest{Code: link.Code})
+	require.NoError(t, err)
+	assert.Equal(t, expURL, got.Url)
+
+	l, err := client.GetLink(ctx, &shortenerv1.GetLinkRequest{Code: link.Code})
+	require.NoError(t, err)
+	assert.Equal(t, expURL, l.Url)
+	assert.Equal(t, "alice", l.Owner)
+	assert.Equal(t, []string{"grpc"}, l.Tags)
+	assert.Equal(t, int64(1), l.Clicks)
+	assert.Nil(t, l.ClicksLeft)
+	assert.False(t, l.Protected)
+
+	_, err = client.DeleteLink(ctx, &shortenerv1.DeleteLinkRequest{Code: link.Code})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	wrong := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong")
+	_, err = client.DeleteLink(wrong, &shortenerv1.DeleteLinkRequest{Code: link.Code})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.DeleteLink(authorized, &shortenerv1.DeleteLinkRequest{Code: link.Code})
+	require.NoError(t, err)
+
+	_, err = client.GetLink(ctx, &shortenerv1.GetLinkRequest{Code: link.Code})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.DeleteLink(authorized, &shortenerv1.DeleteLinkRequest{Code: link.Code})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	t.Run("invalid code", func(t *testing.T) {
+		_, err := client.GetLink(ctx, &shortenerv1.GetLinkRequest{Code: "!!!"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("password", func(t *testing.T) {
+		link, err := client.Shorten(ctx, &shortenerv1.ShortenRequest{
+			Url:      "https://www.testurl.com/grpc/" + uuid.NewString(),
+			Password: "secret",
+		})
+		require.NoError(t, err)
+
+		_, err = client.Expand(ctx, &shortenerv1.ExpandRequest{Code: link.Code})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = client.Expand(ctx, &shortenerv1.ExpandRequest{Code: link.Code, Password: "secret"})
+		assert.NoError(t, err)
+
+		l, err := client.GetLink(ctx, &shortenerv1.GetLinkRequest{Code: link.Code})
+		require.NoError(t, err)
+		assert.True(t, l.Protected)
+		assert.Empty(t, l.Url)
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		_, err := client.Shorten(ctx, &shortenerv1.ShortenRequest{
+			Url:    "https://www.testurl.com/grpc/" + uuid.NewString(),
+			Domain: "unknown." + uuid.NewString() + ".com",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		expURL := "https://www.testurl.com/grpc/" + uuid.NewString()
+		resp, err := client.BatchShorten(ctx, &shortenerv1.BatchShortenRequest{Links: []*shortenerv1.ShortenRequest{
+			{Url: expURL},
+			{Url: "hjef"},
+		}})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 2)
+
+		require.NotNil(t, resp.Results[0].GetLink())
+		got, err := client.Expand(ctx, &shortenerv1.ExpandRequest{Code: resp.Results[0].GetLink().Code})
+		require.NoError(t, err)
+		assert.Equal(t, expURL, got.Url)
+
+		require.NotNil(t, resp.Results[1].GetError())
+		assert.Equal(t, int32(codes.InvalidArgument), resp.Results[1].GetError().Code)
+	})
+}
+
+func TestAPIConfig_Store(t *testing.T) {
+	t.Parallel()
+	store := shortener.New(postgresDB)
+	client := shortenerv1.NewShortenerServiceClient(dial(t, rpc.APIConfig{Log: stdLgr, DB: postgresDB, Store: &store}))
+	ctx := context.Background()
+
+	link, err := client.Shorten(ctx, &shortenerv1.ShortenRequest{
+		Url:      "https://www.testurl.com/grpc/" + uuid.NewString(),
+		Password: "secret",
+	})
+	require.NoError(t, err)
+	for i := 0; i < shortener.MaxPasswordAttempts; i++ {
+		_, err := client.Expand(ctx, &shortenerv1.ExpandRequest{Code: link.Code, Password: "wrong"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	// The attempts of the calls are counted by the engine the HTTP routes are given too.
+	domain, err := store.Domain(ctx, shortener.DefaultDomain)
+	require.NoError(t, err)
+	_, err = store.Expand(ctx, domain, link.Code, shortener.Visit{Password: "secret"})
+	assert.ErrorIs(t, err, shortener.RateLimitedErr)
+}
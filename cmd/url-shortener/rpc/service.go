@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	shortenerv1 "github.com/illyasch/url-shortener/pkg/api/shortener/v1"
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+// MaxBatch is the most links BatchShorten shortens in one call.
+const MaxBatch = 100
+
+// internalMessage is the message of the Internal errors, their details are only logged.
+const internalMessage = "the server failed to handle the request"
+
+// service implements the ShortenerService on the shortener engine.
+type service struct {
+	shortenerv1.UnimplementedShortenerServiceServer
+
+	cfg   APIConfig
+	store shortener.Engine
+}
+
+// Shorten saves a URL and returns the code of its link.
+func (s *service) Shorten(ctx context.Context, req *shortenerv1.ShortenRequest) (*shortenerv1.ShortenResponse, error) {
+	return s.shorten(ctx, req)
+}
+
+// BatchShorten shortens the links one by one, the failure of a link does not stop the others.
+func (s *service) BatchShorten(ctx context.Context, req *shortenerv1.BatchShortenRequest) (*shortenerv1.BatchShortenResponse, error) {
+	if len(req.Links) > MaxBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "batch can have at most %d links", MaxBatch)
+	}
+
+	resp := shortenerv1.BatchShortenResponse{
+		Results: make([]*shortenerv1.BatchShortenResult, 0, len(req.Links)),
+	}
+	for _, l := range req.Links {
+		link, err := s.shorten(ctx, l)
+		if err != nil {
+			st := status.Convert(err)
+			resp.Results = append(resp.Results, &shortenerv1.BatchShortenResult{
+				Result: &shortenerv1.BatchShortenResult_Error{Error: &shortenerv1.Error{
+					Code:    int32(st.Code()),
+					Message: st.Message(),
+				}},
+			})
+			continue
+		}
+
+		resp.Results = append(resp.Results, &shortenerv1.BatchShortenResult{
+			Result: &shortenerv1.BatchShortenResult_Link{Link: link},
+		})
+	}
+
+	return &resp, nil
+}
+
+// shorten validates the link and shortens it in its domain.
+func (s *service) shorten(ctx context.Context, req *shortenerv1.ShortenRequest) (*shortenerv1.ShortenResponse, error) {
+	nl := newLink(req)
+	if err := nl.Validate(); err != nil {
+		s.cfg.log(ctx).Errorw("shorten", "ERROR", fmt.Errorf("validation url(%s): %w", nl.URL, err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	domain, err := s.domain(ctx, req.Domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.cfg.log(ctx).Errorw("shorten", "ERROR", fmt.Errorf("validation domain(%s): %w", req.Domain, err))
+		return nil, status.Error(codes.InvalidArgument, "domain is unknown")
+	}
+	if err != nil {
+		return nil, s.fail(ctx, "shorten", fmt.Errorf("finding domain: %w", err))
+	}
+
+	code, err := s.store.Shorten(ctx, domain, nl)
+	if err != nil {
+		return nil, s.fail(ctx, "shorten", fmt.Errorf("shortening: %w", err))
+	}
+
+	return &shortenerv1.ShortenResponse{Code: code, ShortUrl: s.cfg.shortURL(domain.Name, code)}, nil
+}
+
+// Expand returns the destination of the link and counts a click. The redirect rules
+// matching on the visitors' devices, languages and countries do not match the calls.
+func (s *service) Expand(ctx context.Context, req *shortenerv1.ExpandRequest) (*shortenerv1.ExpandResponse, error) {
+	domain, err := s.domain(ctx, req.Domain)
+	if err != nil {
+		return nil, s.fail(ctx, "expand", fmt.Errorf("finding domain: %w", err))
+	}
+
+	dest, err := s.store.Expand(ctx, domain, req.Code, shortener.Visit{Password: req.Password, Path: req.Path})
+	if err != nil {
+		return nil, s.fail(ctx, "expand", fmt.Errorf("expanding code(%s): %w", req.Code, err))
+	}
+
+	return &shortenerv1.ExpandResponse{
+		Url:      dest.URL,
+		ShortUrl: s.cfg.shortURL(domain.Name, req.Code),
+		Variant:  dest.Variant,
+		Warning:  dest.Warning,
+	}, nil
+}
+
+// GetLink returns the link without counting a click. The destinations of the links
+// protected by a password are left out.
+func (s *service) GetLink(ctx context.Context, req *shortenerv1.GetLinkRequest) (*shortenerv1.Link, error) {
+	domain, err := s.domain(ctx, req.Domain)
+	if err != nil {
+		return nil, s.fail(ctx, "get link", fmt.Errorf("finding domain: %w", err))
+	}
+
+	l, err := s.store.Link(ctx, domain, req.Code)
+	if err != nil {
+		return nil, s.fail(ctx, "get link", fmt.Errorf("finding code(%s): %w", req.Code, err))
+	}
+	l = l.Redacted()
+
+	return &shortenerv1.Link{
+		Code:          l.Code(),
+		Domain:        l.Domain,
+		ShortUrl:      s.cfg.shortURL(l.Domain, l.Code()),
+		Url:           l.URL,
+		Owner:         l.Owner,
+		Tags:          l.Tags,
+		Clicks:        l.Clicks,
+		ClicksLeft:    l.ClicksLeft,
+		Protected:     l.Protected(),
+		Disabled:      l.Disabled,
+		Passthrough:   l.Passthrough.Enabled,
+		QueryConflict: l.QueryConflict,
+		UtmSource:     l.UTM.Source,
+		UtmMedium:     l.UTM.Medium,
+		UtmCampaign:   l.UTM.Campaign,
+		UtmDisabled:   l.UTMDisabled,
+		Warn:          string(l.Warn),
+		Flagged:       l.Flagged,
+		NotBefore:     timestamp(l.NotBefore),
+		NotAfter:      timestamp(l.NotAfter),
+		SoonUrl:       l.SoonURL,
+		EndedUrl:      l.EndedURL,
+		DateCreated:   timestamppb.New(l.DateCreated),
+	}, nil
+}
+
+// DeleteLink removes the link with its clicks.
+func (s *service) DeleteLink(ctx context.Context, req *shortenerv1.DeleteLinkRequest) (*emptypb.Empty, error) {
+	domain, err := s.domain(ctx, req.Domain)
+	if err != nil {
+		return nil, s.fail(ctx, "delete link", fmt.Errorf("finding domain: %w", err))
+	}
+
+	if err := s.store.Delete(ctx, domain, req.Code); err != nil {
+		return nil, s.fail(ctx, "delete link", fmt.Errorf("deleting code(%s): %w", req.Code, err))
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// domain finds the domain named by the request or, when the name is empty, the default domain.
+func (s *service) domain(ctx context.Context, name string) (shortener.Domain, error) {
+	if name == "" {
+		name = shortener.DefaultDomain
+	}
+
+	return s.store.Domain(ctx, name)
+}
+
+// fail logs the error of the call and returns its status.
+func (s *service) fail(ctx context.Context, method string, err error) error {
+	s.cfg.log(ctx).Errorw(method, "ERROR", err)
+
+	code, msg := linkStatus(err)
+	return status.Error(code, msg)
+}
+
+// linkStatus maps an error of finding or opening a link to the code and the message of its
+// status. The unknown errors are internal, their details are only logged.
+func linkStatus(err error) (codes.Code, string) {
+	switch {
+	case errors.Is(err, shortener.EncShiftErr):
+		return codes.InvalidArgument, shortener.EncShiftErr.Error()
+	case errors.Is(err, shortener.DecodeErr):
+		return codes.InvalidArgument, shortener.DecodeErr.Error()
+	case errors.Is(err, shortener.TemplateErr):
+		return codes.InvalidArgument, shortener.TemplateErr.Error()
+	case errors.Is(err, sql.ErrNoRows):
+		return codes.NotFound, "link is not found"
+	case errors.Is(err, shortener.PassthroughErr):
+		return codes.NotFound, shortener.PassthroughErr.Error()
+	case errors.Is(err, shortener.NotStartedErr):
+		return codes.FailedPrecondition, shortener.NotStartedErr.Error()
+	case errors.Is(err, shortener.ExpiredErr):
+		return codes.FailedPrecondition, shortener.ExpiredErr.Error()
+	case errors.Is(err, shortener.DisabledErr):
+		return codes.FailedPrecondition, shortener.DisabledErr.Error()
+	case errors.Is(err, shortener.ExhaustedErr):
+		return codes.FailedPrecondition, shortener.ExhaustedErr.Error()
+	case errors.Is(err, shortener.PasswordRequiredErr):
+		return codes.Unauthenticated, shortener.PasswordRequiredErr.Error()
+	case errors.Is(err, shortener.PasswordErr):
+		return codes.Unauthenticated, shortener.PasswordErr.Error()
+	case errors.Is(err, shortener.RateLimitedErr):
+		return codes.ResourceExhausted, shortener.RateLimitedErr.Error()
+	case errors.Is(err, shortener.ForbiddenErr):
+		return codes.PermissionDenied, shortener.ForbiddenErr.Error()
+	}
+
+	return codes.Internal, internalMessage
+}
+
+// newLink converts the request to the link to shorten.
+func newLink(req *shortenerv1.ShortenRequest) shortener.NewLink {
+	nl := shortener.NewLink{
+		URL:   req.Url,
+		Owner: req.Owner,
+		Tags:  req.Tags,
+		Schedule: shortener.Schedule{
+			SoonURL:  req.SoonUrl,
+			EndedURL: req.EndedUrl,
+		},
+		Password:  req.Password,
+		MaxClicks: req.MaxClicks,
+		Passthrough: shortener.Passthrough{
+			Enabled:       req.Passthrough,
+			QueryConflict: req.QueryConflict,
+		},
+		UTM: shortener.UTM{
+			Source:   req.UtmSource,
+			Medium:   req.UtmMedium,
+			Campaign: req.UtmCampaign,
+		},
+		UTMDisabled: req.UtmDisabled,
+		Warn:        shortener.Warn(req.Warn),
+	}
+	if req.NotBefore != nil {
+		t := req.NotBefore.AsTime()
+		nl.Schedule.NotBefore = &t
+	}
+	if req.NotAfter != nil {
+		t := req.NotAfter.AsTime()
+		nl.Schedule.NotAfter = &t
+	}
+
+	return nl
+}
+
+// timestamp converts an optional time of a link.
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
@@ -9,18 +9,27 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ardanlabs/conf/v3"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"github.com/illyasch/url-shortener/cmd/url-shortener/handlers"
+	"github.com/illyasch/url-shortener/cmd/url-shortener/rpc"
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
 	"github.com/illyasch/url-shortener/pkg/data/database"
+	"github.com/illyasch/url-shortener/pkg/sys/geoip"
 	"github.com/illyasch/url-shortener/pkg/sys/logger"
+	"github.com/illyasch/url-shortener/pkg/sys/metrics"
+	"github.com/illyasch/url-shortener/pkg/sys/tracing"
 )
 
 const configPrefix = "SHORTENER"
@@ -37,11 +46,29 @@ type config struct {
 		DisableTLS   bool   `conf:"default:true"`
 	}
 	Web struct {
-		ReadTimeout     time.Duration `conf:"default:5s"`
-		WriteTimeout    time.Duration `conf:"default:10s"`
-		IdleTimeout     time.Duration `conf:"default:120s"`
-		ShutdownTimeout time.Duration `conf:"default:20s"`
-		APIHost         string        `conf:"default:0.0.0.0:3000"`
+		ReadTimeout       time.Duration `conf:"default:5s"`
+		WriteTimeout      time.Duration `conf:"default:10s"`
+		IdleTimeout       time.Duration `conf:"default:120s"`
+		ShutdownTimeout   time.Duration `conf:"default:20s"`
+		APIHost           string        `conf:"default:0.0.0.0:3000"`
+		DebugHost         string        `conf:"default:0.0.0.0:4000"`
+		GRPCHost          string        `conf:"default:0.0.0.0:5000,help:host and port of the gRPC API"`
+		DebugWriteTimeout time.Duration `conf:"default:60s,help:write timeout of the debug routes; CPU profiles and traces take 30s by default"`
+		PublicBaseURL     string        `conf:"help:absolute URL the short links are built on; taken from the request when empty"`
+		PathPrefix        string        `conf:"help:path prefix the routes are mounted under"`
+		TemplatesDir      string        `conf:"help:directory with HTML templates overriding the embedded ones"`
+		Sunset            time.Time     `conf:"default:2027-01-01T00:00:00Z,help:date the deprecated unversioned routes are removed on"`
+		TrustedProxies    []string      `conf:"help:addresses or CIDRs of the reverse proxies the client addresses are taken from X-Forwarded-For of; separated by ;"`
+		APIKeys           []string      `conf:"mask,help:keys the clients changing the links send as their bearer tokens; separated by ;"`
+	}
+	GeoIP struct {
+		File string `conf:"help:MaxMind country database file the redirect rules match countries with"`
+	}
+	Tracing struct {
+		Exporter    string  `conf:"default:none,help:exporter of the spans: otlp, stdout or none"`
+		Endpoint    string  `conf:"default:localhost:4318,help:host and port of the OTLP/HTTP collector"`
+		Insecure    bool    `conf:"default:true,help:send the spans to the collector without TLS"`
+		Probability float64 `conf:"default:1,help:share of the traces started by the service which are sampled"`
 	}
 }
 
@@ -64,7 +91,7 @@ func main() {
 }
 
 func run(logger *zap.SugaredLogger) error {
-	cfg, err := parseConfig(configPrefix, logger)
+	cfg, cfgOut, err := parseConfig(configPrefix, logger)
 	if err != nil {
 		if errors.Is(err, conf.ErrHelpWanted) {
 			return nil
@@ -79,6 +106,32 @@ func run(logger *zap.SugaredLogger) error {
 	defer logger.Infow("shutdown complete")
 	expvar.NewString("build").Set(build)
 
+	// =========================================================================
+	// Start Tracing Support
+
+	logger.Infow("startup", "status", "initializing tracing support", "exporter", cfg.Tracing.Exporter)
+
+	stopTracing, err := tracing.Start(context.Background(), tracing.Config{
+		ServiceName: "url-shortener",
+		Build:       build,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		Probability: cfg.Tracing.Probability,
+	})
+	if err != nil {
+		return fmt.Errorf("starting tracing: %w", err)
+	}
+	defer func() {
+		logger.Infow("shutdown", "status", "stopping tracing support")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stopTracing(ctx); err != nil {
+			logger.Errorw("shutdown", "ERROR", fmt.Errorf("tracing stop: %w", err))
+		}
+	}()
+
 	// =========================================================================
 	// Database Support
 
@@ -109,15 +162,65 @@ func run(logger *zap.SugaredLogger) error {
 
 	logger.Infow("startup", "status", "initializing V1 API support")
 
+	mtr := metrics.New(db.DB)
+
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	if cfg.Web.PublicBaseURL != "" {
+		u, err := url.Parse(cfg.Web.PublicBaseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("public base url %q must be an absolute URL", cfg.Web.PublicBaseURL)
+		}
+	}
+
+	proxies, err := parseNetworks(cfg.Web.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+
+	if len(cfg.Web.APIKeys) == 0 {
+		logger.Infow("startup", "status", "no API keys, the links can not be changed through the API")
+	}
+
+	pages, err := handlers.LoadPages(cfg.Web.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("loading pages: %w", err)
+	}
+
+	var geo *geoip.DB
+	if cfg.GeoIP.File != "" {
+		logger.Infow("startup", "status", "opening geoip database", "file", cfg.GeoIP.File)
+
+		if geo, err = geoip.Open(cfg.GeoIP.File); err != nil {
+			return fmt.Errorf("opening geoip database: %w", err)
+		}
+		defer func() {
+			if err := geo.Close(); err != nil {
+				logger.Errorw("shutdown", "ERROR", fmt.Errorf("geoip close: %w", err))
+			}
+		}()
+	}
+
+	// Construct the engine of the links. The HTTP routes and the gRPC server share it,
+	// so the failed password attempts of a link are counted across both of them.
+	store := shortener.New(db)
+
 	// Construct the mux for the API calls.
 	apiMux := handlers.APIConfig{
-		DB:  db,
-		Log: logger,
+		DB:             db,
+		Log:            logger,
+		Store:          &store,
+		PublicBaseURL:  cfg.Web.PublicBaseURL,
+		PathPrefix:     cfg.Web.PathPrefix,
+		Pages:          pages,
+		GeoIP:          geo,
+		Metrics:        mtr,
+		Sunset:         cfg.Web.Sunset,
+		TrustedProxies: proxies,
+		APIKeys:        cfg.Web.APIKeys,
 	}.Router()
 
 	// Construct a server to service the requests against the mux.
@@ -130,9 +233,35 @@ func run(logger *zap.SugaredLogger) error {
 		ErrorLog:     zap.NewStdLog(logger.Desugar()),
 	}
 
-	// Make a channel to listen for errors coming from the listener. Use a
-	// buffered channel so the goroutine can exit if we don't collect this error.
-	serverErrors := make(chan error, 1)
+	// Construct a server for the debug routes. It is kept off the API host,
+	// so the profiles, the metrics and the config are not exposed with the API.
+	debug := http.Server{
+		Addr:         cfg.Web.DebugHost,
+		Handler:      handlers.DebugMux(logger, cfgOut, mtr),
+		ReadTimeout:  cfg.Web.ReadTimeout,
+		WriteTimeout: cfg.Web.DebugWriteTimeout,
+		IdleTimeout:  cfg.Web.IdleTimeout,
+		ErrorLog:     zap.NewStdLog(logger.Desugar()),
+	}
+
+	// Construct the gRPC server of the API. It shares the engine with the HTTP
+	// routes, the short URLs of its responses are built on the public base URL.
+	grpcSrv := rpc.APIConfig{
+		DB:            db,
+		Log:           logger,
+		Store:         &store,
+		PublicBaseURL: cfg.Web.PublicBaseURL,
+		APIKeys:       cfg.Web.APIKeys,
+	}.Server()
+
+	grpcListener, err := net.Listen("tcp", cfg.Web.GRPCHost)
+	if err != nil {
+		return fmt.Errorf("listening grpc: %w", err)
+	}
+
+	// Make a channel to listen for errors coming from the listeners. Use a
+	// buffered channel so the goroutines can exit if we don't collect these errors.
+	serverErrors := make(chan error, 3)
 
 	// Start the service listening for srv requests.
 	go func() {
@@ -140,10 +269,26 @@ func run(logger *zap.SugaredLogger) error {
 		serverErrors <- srv.ListenAndServe()
 	}()
 
+	// Start the service listening for debug requests.
+	go func() {
+		logger.Infow("startup", "status", "debug router started", "host", debug.Addr)
+		if err := debug.ListenAndServe(); err != nil {
+			serverErrors <- fmt.Errorf("debug: %w", err)
+		}
+	}()
+
+	// Start the service listening for gRPC calls.
+	go func() {
+		logger.Infow("startup", "status", "grpc server started", "host", cfg.Web.GRPCHost)
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			serverErrors <- fmt.Errorf("grpc: %w", err)
+		}
+	}()
+
 	// =========================================================================
 	// Shutdown
 
-	// Blocking main and waiting for shutdown.
+	// Blocking main and waiting for shutdown. The servers are shut down together.
 	select {
 	case err := <-serverErrors:
 		return fmt.Errorf("server error: %w", err)
@@ -156,19 +301,71 @@ func run(logger *zap.SugaredLogger) error {
 		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancel()
 
-		// Asking listener to shut down and shed load.
-		if err := srv.Shutdown(ctx); err != nil {
-			if cErr := srv.Close(); cErr != nil {
-				logger.Errorw("shutdown", "ERROR", fmt.Errorf("server close: %w", cErr))
+		// Asking listeners to shut down and shed load.
+		var shutdownErr error
+		if err := stopGRPC(ctx, grpcSrv); err != nil {
+			shutdownErr = fmt.Errorf("could not stop grpc server %s gracefully: %w", cfg.Web.GRPCHost, err)
+		}
+		for _, s := range []*http.Server{&srv, &debug} {
+			if err := s.Shutdown(ctx); err != nil {
+				if cErr := s.Close(); cErr != nil {
+					logger.Errorw("shutdown", "ERROR", fmt.Errorf("server %s close: %w", s.Addr, cErr))
+				}
+				shutdownErr = fmt.Errorf("could not stop server %s gracefully: %w", s.Addr, err)
 			}
-			return fmt.Errorf("could not stop server gracefully: %w", err)
+		}
+		if shutdownErr != nil {
+			return shutdownErr
 		}
 	}
 
 	return nil
 }
 
-func parseConfig(prefix string, logger *zap.SugaredLogger) (config, error) {
+// parseNetworks parses the CIDRs, a single address is a network of its own.
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%q must be an address or a CIDR", cidr)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// stopGRPC waits for the outstanding calls of the gRPC server until the deadline
+// of the context and then stops the server, cancelling the calls left.
+func stopGRPC(ctx context.Context, srv *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// parseConfig parses the config and returns it together with its rendering with the secrets masked.
+func parseConfig(prefix string, logger *zap.SugaredLogger) (config, string, error) {
 	cfg := config{
 		Version: conf.Version{
 			Build: build,
@@ -179,14 +376,14 @@ func parseConfig(prefix string, logger *zap.SugaredLogger) (config, error) {
 	help, err := conf.Parse(prefix, &cfg)
 	if err != nil {
 		fmt.Println(help)
-		return cfg, err
+		return cfg, "", err
 	}
 
 	out, err := conf.String(&cfg)
 	if err != nil {
-		return cfg, fmt.Errorf("generating config for output: %w", err)
+		return cfg, "", fmt.Errorf("generating config for output: %w", err)
 	}
 	logger.Infow("startup", "config", out)
 
-	return cfg, nil
+	return cfg, out, nil
 }
@@ -0,0 +1,79 @@
+package shortener
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits of the failed password attempts. After MaxPasswordAttempts failures
+// a link can not be opened with a password until its window is over.
+const (
+	MaxPasswordAttempts    = 5
+	PasswordAttemptsWindow = 15 * time.Minute
+)
+
+// attempts counts the failed password attempts per link in fixed windows.
+// The counters are kept in memory, so every instance of the service limits
+// the attempts on its own.
+type attempts struct {
+	mu       sync.Mutex
+	failures map[int64]*window
+}
+
+type window struct {
+	count int
+	end   time.Time
+}
+
+func newAttempts() *attempts {
+	return &attempts{failures: map[int64]*window{}}
+}
+
+// blocked reports whether the link has run out of attempts.
+func (a *attempts) blocked(id int64, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.failures[id]
+	return ok && now.Before(w.end) && w.count >= MaxPasswordAttempts
+}
+
+// reserve counts an attempt of the link as failed before its password is compared, so the
+// concurrent attempts can not all pass the limit before any of them fails. It reports false
+// when the link has run out of attempts. The attempts which succeed are released.
+func (a *attempts) reserve(id int64, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.failures[id]
+	if !ok || !now.Before(w.end) {
+		a.prune(now)
+		w = &window{end: now.Add(PasswordAttemptsWindow)}
+		a.failures[id] = w
+	}
+	if w.count >= MaxPasswordAttempts {
+		return false
+	}
+
+	w.count++
+	return true
+}
+
+// release takes back the attempt of the link reserved by the attempt which succeeded.
+func (a *attempts) release(id int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if w, ok := a.failures[id]; ok && w.count > 0 {
+		w.count--
+	}
+}
+
+// prune forgets the windows which are over. It must be called with a.mu held.
+func (a *attempts) prune(now time.Time) {
+	for id, w := range a.failures {
+		if !now.Before(w.end) {
+			delete(a.failures, id)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultDomain is the name of the domain serving the hosts which are not
+// registered as domains of their own.
+const DefaultDomain = "default"
+
+// Domain is a branded host the short links are served from. Every domain
+// has its own space of codes.
+type Domain struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+
+	// AllowedDomains restricts the destinations of the domain's links to
+	// these domains and their subdomains. Any destination is allowed when
+	// the list is empty.
+	AllowedDomains pq.StringArray `db:"allowed_domains"`
+
+	// FallbackURL is the page visitors are sent to when a code is not found.
+	FallbackURL string    `db:"fallback_url"`
+	DateCreated time.Time `db:"date_created"`
+
+	// UTM are the default UTM parameters of the domain's links.
+	UTM
+
+	// Interstitial warns the visitors of the domain's links before sending them away.
+	Interstitial
+}
+
+// Validate checks that the fallback page is an absolute http(s) URL.
+func (d Domain) Validate() error {
+	if d.FallbackURL != "" && !webURL(d.FallbackURL) {
+		return errors.New("fallback url must be an absolute http(s) URL")
+	}
+
+	return nil
+}
+
+// IsDefault reports whether d is the default domain.
+func (d Domain) IsDefault() bool {
+	return d.Name == DefaultDomain
+}
+
+// Allows reports whether the domain's policy allows links to the host.
+func (d Domain) Allows(host string) bool {
+	if len(d.AllowedDomains) == 0 {
+		return true
+	}
+
+	return inDomains(host, d.AllowedDomains)
+}
+
+// inDomains reports whether the host is one of the domains or their subdomains.
+func inDomains(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Domain finds the domain by its name.
+func (e Engine) Domain(ctx context.Context, name string) (Domain, error) {
+	const sql = `SELECT id, name, allowed_domains, fallback_url, utm_source, utm_medium, utm_campaign,
+						interstitial, interstitial_delay, trusted_domains, date_created FROM domains WHERE name = $1`
+
+	var d Domain
+	if err := e.DB.GetContext(ctx, &d, sql, strings.ToLower(name)); err != nil {
+		return Domain{}, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return d, nil
+}
+
+// ResolveDomain finds the domain serving the host. It is the domain named
+// after the host or the default domain if there is no such domain.
+func (e Engine) ResolveDomain(ctx context.Context, host string) (Domain, error) {
+	const sql = `SELECT id, name, allowed_domains, fallback_url, utm_source, utm_medium, utm_campaign,
+						interstitial, interstitial_delay, trusted_domains, date_created FROM domains
+					WHERE name = $1 OR name = $2 ORDER BY name = $2 LIMIT 1`
+
+	var d Domain
+	if err := e.DB.GetContext(ctx, &d, sql, strings.ToLower(host), DefaultDomain); err != nil {
+		return Domain{}, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return d, nil
+}
+
+// Domains returns all the domains ordered by name.
+func (e Engine) Domains(ctx context.Context) ([]Domain, error) {
+	const sql = `SELECT id, name, allowed_domains, fallback_url, utm_source, utm_medium, utm_campaign,
+						interstitial, interstitial_delay, trusted_domains, date_created FROM domains ORDER BY name`
+
+	domains := []Domain{}
+	if err := e.DB.SelectContext(ctx, &domains, sql); err != nil {
+		return nil, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return domains, nil
+}
+
+// SaveDomain creates a domain or updates the policy of an existing one.
+func (e Engine) SaveDomain(ctx context.Context, d Domain) error {
+	const sql = `INSERT INTO domains(name, allowed_domains, fallback_url) VALUES ($1, $2, $3)
+					ON CONFLICT(name) DO UPDATE SET allowed_domains = $2, fallback_url = $3`
+
+	if d.Name == "" {
+		return errors.New("domain name is empty")
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	allowed := d.AllowedDomains
+	if allowed == nil {
+		allowed = pq.StringArray{}
+	}
+
+	if _, err := e.DB.ExecContext(ctx, sql, strings.ToLower(d.Name), allowed, d.FallbackURL); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
+
+// DeleteDomain deletes a domain which has no links.
+func (e Engine) DeleteDomain(ctx context.Context, name string) error {
+	const sql = `DELETE FROM domains WHERE name = $1 RETURNING id`
+
+	if strings.EqualFold(name, DefaultDomain) {
+		return errors.New("the default domain can not be deleted")
+	}
+
+	var id int64
+	if err := e.DB.QueryRowxContext(ctx, sql, strings.ToLower(name)).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
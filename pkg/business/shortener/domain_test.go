@@ -0,0 +1,20 @@
+package shortener_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestDomain_Validate(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, shortener.Domain{Name: "go.testurl.com"}.Validate())
+	assert.NoError(t, shortener.Domain{Name: "go.testurl.com", FallbackURL: "https://testurl.com/404"}.Validate())
+
+	for _, fallback := range []string{"testurl.com/404", "/404", "ftp://testurl.com/404", "javascript:alert(1)", "https://"} {
+		assert.Error(t, shortener.Domain{Name: "go.testurl.com", FallbackURL: fallback}.Validate(), fallback)
+	}
+}
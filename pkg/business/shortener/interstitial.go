@@ -0,0 +1,122 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MaxInterstitialDelay is the longest time in seconds the continue button of the interstitial page can be held back.
+const MaxInterstitialDelay = 60
+
+// Warn is the way a link shows the interstitial page before sending the visitor to the destination.
+type Warn string
+
+// The ways a link shows the interstitial page. The flagged links show it whatever the way is.
+const (
+	// WarnDomain shows the page when the interstitial of the domain applies to the destination.
+	WarnDomain Warn = ""
+
+	// WarnAlways shows the page for any destination.
+	WarnAlways Warn = "always"
+
+	// WarnNever does not show the page.
+	WarnNever Warn = "never"
+)
+
+// Reasons the visitor is shown the interstitial page.
+const (
+	WarningExternal = "external"
+	WarningFlagged  = "flagged"
+)
+
+// Validate checks that the way is one of the Warn constants.
+func (w Warn) Validate() error {
+	switch w {
+	case WarnDomain, WarnAlways, WarnNever:
+		return nil
+	}
+
+	return fmt.Errorf("warn must be %s or %s", WarnAlways, WarnNever)
+}
+
+// Interstitial is the warning page the visitors of a domain's links are
+// shown before going to a destination outside of the trusted domains.
+type Interstitial struct {
+	Enabled bool `db:"interstitial"`
+
+	// Delay is the number of seconds the continue button is held back for.
+	Delay int `db:"interstitial_delay"`
+
+	// Trusted are the domains which, together with their subdomains, are
+	// not warned about.
+	Trusted pq.StringArray `db:"trusted_domains"`
+}
+
+// Validate checks the delay.
+func (i Interstitial) Validate() error {
+	if i.Delay < 0 || i.Delay > MaxInterstitialDelay {
+		return fmt.Errorf("interstitial delay must be from 0 to %d seconds", MaxInterstitialDelay)
+	}
+
+	return nil
+}
+
+// Warns reports whether the visitors going to the host are shown the page.
+func (i Interstitial) Warns(host string) bool {
+	return i.Enabled && !inDomains(host, i.Trusted)
+}
+
+// warning returns the reason to show the visitor of a link going to the host
+// the interstitial page of the domain, it is empty when the page is not shown.
+func warning(d Domain, warn Warn, flagged bool, host string) string {
+	switch {
+	case flagged:
+		return WarningFlagged
+	case warn == WarnAlways, warn == WarnDomain && d.Interstitial.Warns(host):
+		return WarningExternal
+	}
+
+	return ""
+}
+
+// SetDomainInterstitial sets the interstitial page of the domain's links.
+func (e Engine) SetDomainInterstitial(ctx context.Context, name string, i Interstitial) error {
+	const sql = `UPDATE domains SET interstitial = $2, interstitial_delay = $3, trusted_domains = $4
+					WHERE name = $1 RETURNING id`
+
+	if err := i.Validate(); err != nil {
+		return err
+	}
+
+	trusted := i.Trusted
+	if trusted == nil {
+		trusted = pq.StringArray{}
+	}
+
+	var id int64
+	if err := e.DB.QueryRowxContext(ctx, sql, strings.ToLower(name), i.Enabled, i.Delay, trusted).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
+
+// SetFlagged flags the link with the code in the domain as unsafe or clears the flag.
+// The visitors of a flagged link are always shown the interstitial page.
+func (e Engine) SetFlagged(ctx context.Context, d Domain, code string, flagged bool) error {
+	const sql = `UPDATE urls SET flagged = $3 WHERE domain_id = $1 AND code_id = $2 RETURNING code_id`
+
+	id, err := Decode(code)
+	if err != nil {
+		return err
+	}
+
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, id, flagged).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
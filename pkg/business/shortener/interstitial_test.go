@@ -0,0 +1,49 @@
+package shortener_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestInterstitial_Warns(t *testing.T) {
+	t.Parallel()
+
+	on := shortener.Interstitial{Enabled: true, Trusted: []string{"testurl.com"}}
+
+	tests := []struct {
+		name         string
+		interstitial shortener.Interstitial
+		host         string
+		exp          bool
+	}{
+		{"external host", on, "www.example.com", true},
+		{"trusted domain", on, "testurl.com", false},
+		{"trusted subdomain", on, "WWW.testurl.com", false},
+		{"lookalike domain", on, "nottesturl.com", true},
+		{"nothing trusted", shortener.Interstitial{Enabled: true}, "testurl.com", true},
+		{"turned off", shortener.Interstitial{}, "www.example.com", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.exp, tt.interstitial.Warns(tt.host))
+		})
+	}
+}
+
+func TestInterstitial_Validate(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, shortener.Interstitial{Delay: shortener.MaxInterstitialDelay}.Validate())
+	assert.Error(t, shortener.Interstitial{Delay: -1}.Validate())
+	assert.Error(t, shortener.Interstitial{Delay: shortener.MaxInterstitialDelay + 1}.Validate())
+
+	assert.NoError(t, shortener.WarnAlways.Validate())
+	assert.Error(t, shortener.Warn("sometimes").Validate())
+}
@@ -0,0 +1,34 @@
+package shortener
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonValue encodes v for a JSONB column.
+func jsonValue(v any) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// jsonScan decodes a JSONB column into v. NULL leaves v as it is.
+func jsonScan(src any, v any) error {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,97 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Filter narrows down and paginates the links returned by List.
+// Zero values of the fields are not applied. Host and Search match the
+// destinations, so they never match the links protected by a password.
+type Filter struct {
+	Owner         string
+	Domain        string
+	Host          string
+	Tag           string
+	Search        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// AfterID is the keyset cursor: only links following the one with
+	// this id in the chosen sort order are returned.
+	AfterID int64
+	Desc    bool
+	Limit   int
+}
+
+// List returns the links matching the filter ordered by id.
+func (e Engine) List(ctx context.Context, f Filter) ([]Link, error) {
+	var (
+		where []string
+		args  []any
+	)
+	cond := func(format string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(format, len(args)))
+	}
+
+	if f.Owner != "" {
+		cond("u.owner = $%d", f.Owner)
+	}
+	if f.Domain != "" {
+		cond("d.name = $%d", strings.ToLower(f.Domain))
+	}
+	if f.Host != "" {
+		host := strings.ToLower(f.Host)
+		cond("(u.host = $%[1]d OR right(u.host, length($%[1]d) + 1) = '.' || $%[1]d) AND u.password_hash = ''", host)
+	}
+	if f.Tag != "" {
+		cond("u.tags @> ARRAY[$%d]::TEXT[]", f.Tag)
+	}
+	if f.Search != "" {
+		cond(`u.url ILIKE '%%' || $%d || '%%' ESCAPE '\' AND u.password_hash = ''`, escapeLike(f.Search))
+	}
+	if !f.CreatedAfter.IsZero() {
+		cond("u.date_created >= $%d", f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		cond("u.date_created < $%d", f.CreatedBefore.UTC())
+	}
+
+	order := "ASC"
+	if f.Desc {
+		order = "DESC"
+	}
+	if f.AfterID > 0 {
+		if f.Desc {
+			cond("u.id < $%d", f.AfterID)
+		} else {
+			cond("u.id > $%d", f.AfterID)
+		}
+	}
+
+	sql := `SELECT u.id, u.code_id, d.name AS domain, u.url, u.owner, u.tags, u.clicks, u.not_before,
+					u.not_after, u.soon_url, u.ended_url, u.disabled, u.date_created, u.password_hash, u.clicks_left,
+					u.passthrough, u.query_conflict, u.utm_source, u.utm_medium, u.utm_campaign, u.utm_disabled,
+					u.warn, u.flagged
+				FROM urls u JOIN domains d ON d.id = u.domain_id`
+	if len(where) > 0 {
+		sql += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	sql += fmt.Sprintf(` ORDER BY u.id %s LIMIT $%d`, order, len(args))
+
+	links := []Link{}
+	if err := e.DB.SelectContext(ctx, &links, sql, args...); err != nil {
+		return nil, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return links, nil
+}
+
+// escapeLike escapes the LIKE pattern special characters in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,134 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The ways of merging a visitor's query parameter which the destination URL already has.
+const (
+	// QueryKeep keeps the destination's values.
+	QueryKeep = "keep"
+
+	// QueryOverride replaces the destination's values with the visitor's ones.
+	QueryOverride = "override"
+
+	// QueryAppend adds the visitor's values after the destination's ones.
+	QueryAppend = "append"
+)
+
+// PassthroughErr is returned for the extra path of a link which does not pass paths through.
+var PassthroughErr = errors.New("link does not pass paths through")
+
+// Passthrough makes a link pass the extra path and the query of the short URL
+// through to the destination, e.g. /{code}/guide?x=1 goes to {url}/guide?x=1.
+// The HTTP API serves the QR code of the link on the extra path qr, so that
+// one path is never passed through; qr/guide and the others are.
+type Passthrough struct {
+	Enabled bool `db:"passthrough"`
+
+	// QueryConflict is one of the Query constants, QueryKeep when empty.
+	QueryConflict string `db:"query_conflict"`
+}
+
+// Validate checks the query merging mode.
+func (p Passthrough) Validate() error {
+	switch p.QueryConflict {
+	case "", QueryKeep, QueryOverride, QueryAppend:
+		return nil
+	}
+
+	return fmt.Errorf("query_conflict must be %s, %s or %s", QueryKeep, QueryOverride, QueryAppend)
+}
+
+// Apply appends the escaped extra path to the destination URL and merges the
+// query into its query, see mergeQuery. The extra path must not step out of the destination's
+// path with dot segments.
+func (p Passthrough) Apply(dest string, extraPath string, query url.Values) (string, error) {
+	if !p.Enabled {
+		if extraPath != "" {
+			return "", PassthroughErr
+		}
+		return dest, nil
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", fmt.Errorf("parse destination: %w", err)
+	}
+
+	if extraPath != "" {
+		extra, err := cleanPath(extraPath)
+		if err != nil {
+			return "", err
+		}
+
+		escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + extra
+		if u.Path, err = url.PathUnescape(escaped); err != nil {
+			return "", fmt.Errorf("unescape path: %w", err)
+		}
+		u.RawPath = escaped
+	}
+
+	if len(query) > 0 {
+		u.RawQuery = p.mergeQuery(u.RawQuery, query)
+	}
+
+	return u.String(), nil
+}
+
+// mergeQuery appends the visitor's parameters to the raw query of the
+// destination, which is kept as it is. Only the pairs of the keys the
+// visitor overrides are removed from it.
+func (p Passthrough) mergeQuery(raw string, query url.Values) string {
+	dest, _ := url.ParseQuery(raw)
+	add := url.Values{}
+	overridden := map[string]bool{}
+	for k, vs := range query {
+		_, conflict := dest[k]
+		switch {
+		case !conflict, p.QueryConflict == QueryAppend:
+			add[k] = vs
+		case p.QueryConflict == QueryOverride:
+			add[k] = vs
+			overridden[k] = true
+		}
+	}
+	if len(add) == 0 {
+		return raw
+	}
+
+	if len(overridden) > 0 {
+		var kept []string
+		for _, pair := range strings.Split(raw, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if k, err := url.QueryUnescape(key); err == nil && overridden[k] {
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		raw = strings.Join(kept, "&")
+	}
+
+	return strings.TrimPrefix(raw+"&"+add.Encode(), "&")
+}
+
+// cleanPath re-escapes every segment of the escaped path, so the destination
+// gets the same segments the visitor sent. The dot segments are rejected.
+func cleanPath(escaped string) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(escaped, "/"), "/")
+	for i, s := range segments {
+		seg, err := url.PathUnescape(s)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", DecodeErr, err)
+		}
+		if seg == "." || seg == ".." {
+			return "", fmt.Errorf("%w: dot segment in path", DecodeErr)
+		}
+		segments[i] = url.PathEscape(seg)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,76 @@
+package shortener_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestPassthrough_Apply(t *testing.T) {
+	t.Parallel()
+
+	const (
+		docs = "https://docs.testurl.com/v2/?lang=en"
+		raw  = "https://docs.testurl.com/?b=1&a=x%20y&flag"
+	)
+
+	tests := []struct {
+		name     string
+		conflict string
+		dest     string
+		path     string
+		query    url.Values
+		exp      string
+	}{
+		{"no extra path", shortener.QueryKeep, docs, "", nil, docs},
+		{"extra path", shortener.QueryKeep, docs, "/guide/install", nil, "https://docs.testurl.com/v2/guide/install?lang=en"},
+		{"escaped path", shortener.QueryKeep, "https://docs.testurl.com", "/a%2Fb/c%20d", nil, "https://docs.testurl.com/a%2Fb/c%20d"},
+		{"new query key", shortener.QueryKeep, docs, "", url.Values{"x": {"1"}}, "https://docs.testurl.com/v2/?lang=en&x=1"},
+		{"keep on conflict", shortener.QueryKeep, docs, "", url.Values{"lang": {"de"}}, docs},
+		{"override on conflict", shortener.QueryOverride, docs, "", url.Values{"lang": {"de"}}, "https://docs.testurl.com/v2/?lang=de"},
+		{"append on conflict", shortener.QueryAppend, docs, "", url.Values{"lang": {"de"}}, "https://docs.testurl.com/v2/?lang=en&lang=de"},
+		{"escaped query", shortener.QueryKeep, "https://docs.testurl.com", "", url.Values{"q": {"a&b=c"}}, "https://docs.testurl.com?q=a%26b%3Dc"},
+		{"raw query kept", shortener.QueryKeep, raw, "", url.Values{"x": {"1"}}, raw + "&x=1"},
+		{"raw query kept on conflict", shortener.QueryKeep, raw, "", url.Values{"a": {"z"}}, raw},
+		{"raw query appended on conflict", shortener.QueryAppend, raw, "", url.Values{"a": {"z"}}, raw + "&a=z"},
+		{"raw query overridden on conflict", shortener.QueryOverride, raw, "", url.Values{"a": {"z"}}, "https://docs.testurl.com/?b=1&flag&a=z"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := shortener.Passthrough{Enabled: true, QueryConflict: tt.conflict}
+			got, err := p.Apply(tt.dest, tt.path, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, got)
+		})
+	}
+
+	t.Run("dot segments", func(t *testing.T) {
+		t.Parallel()
+
+		p := shortener.Passthrough{Enabled: true}
+		for _, path := range []string{"/../admin", "/a/%2e%2e/b", "/./a"} {
+			_, err := p.Apply(docs, path, nil)
+			assert.True(t, errors.Is(err, shortener.DecodeErr), path)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := shortener.Passthrough{}.Apply(docs, "", url.Values{"x": {"1"}})
+		require.NoError(t, err)
+		assert.Equal(t, docs, got)
+
+		_, err = shortener.Passthrough{}.Apply(docs, "/guide", nil)
+		assert.True(t, errors.Is(err, shortener.PassthroughErr))
+	})
+}
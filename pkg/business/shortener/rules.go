@@ -0,0 +1,237 @@
+package shortener
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// MaxRules is the most rules a link can have.
+const MaxRules = 32
+
+// Platforms of the visitors' devices the rules match on.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+	PlatformOther   = "other"
+)
+
+// Rule sends the visitors matching all of its conditions to its URL. The
+// empty conditions match every visitor.
+type Rule struct {
+	// Platform is one of the Platform constants.
+	Platform string `json:"platform,omitempty"`
+
+	// Language is a BCP 47 tag matching the most preferred language of the
+	// visitor, e.g. "de" matches "de-CH" and "de-CH" matches only "de-CH".
+	Language string `json:"language,omitempty"`
+
+	// Country is an ISO 3166-1 alpha-2 code of the visitor's country.
+	Country string `json:"country,omitempty"`
+
+	// Query are the query parameters the visitor's request must have.
+	Query map[string]string `json:"query,omitempty"`
+
+	// URL is left out of the rules of the links protected by a password, see Redacted.
+	URL string `json:"url,omitempty"`
+}
+
+// Rules is the ordered list of the rules of a link. It is stored as JSON.
+type Rules []Rule
+
+// Redacted returns a copy of the rules without their URLs for the links protected by a password.
+func (rs Rules) Redacted() Rules {
+	redacted := make(Rules, len(rs))
+	for i, r := range rs {
+		r.URL = ""
+		redacted[i] = r
+	}
+
+	return redacted
+}
+
+// Value implements driver.Valuer.
+func (rs Rules) Value() (driver.Value, error) {
+	if rs == nil {
+		rs = Rules{}
+	}
+
+	return jsonValue(rs)
+}
+
+// Scan implements sql.Scanner.
+func (rs *Rules) Scan(src any) error {
+	return jsonScan(src, rs)
+}
+
+// Validate checks the rules and that the domain allows their destinations.
+// It puts the languages of the rules in their canonical form.
+func (rs Rules) Validate(d Domain) error {
+	if len(rs) > MaxRules {
+		return fmt.Errorf("link can have at most %d rules", MaxRules)
+	}
+
+	for i, r := range rs {
+		u, err := url.Parse(r.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("rule %d: url must be an absolute URL", i+1)
+		}
+		if !d.Allows(Host(r.URL)) {
+			return fmt.Errorf("rule %d: %w", i+1, ForbiddenErr)
+		}
+
+		switch r.Platform {
+		case "", PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux, PlatformOther:
+		default:
+			return fmt.Errorf("rule %d: platform %q is unknown", i+1, r.Platform)
+		}
+
+		if r.Language != "" {
+			tag, err := language.Parse(r.Language)
+			if err != nil {
+				return fmt.Errorf("rule %d: language %q is not a BCP 47 tag", i+1, r.Language)
+			}
+			rs[i].Language = tag.String()
+		}
+
+		if r.Country != "" && len(r.Country) != 2 {
+			return fmt.Errorf("rule %d: country %q is not an ISO 3166-1 alpha-2 code", i+1, r.Country)
+		}
+	}
+
+	return nil
+}
+
+// Match returns the URL of the first rule matching the visit.
+func (rs Rules) Match(v Visit) (string, bool) {
+	if len(rs) == 0 {
+		return "", false
+	}
+
+	platform := Platform(v.UserAgent)
+	lang := preferredLanguage(v.AcceptLanguage)
+	for _, r := range rs {
+		if r.matches(v, platform, lang) {
+			return r.URL, true
+		}
+	}
+
+	return "", false
+}
+
+// matches reports whether the visit matches all the conditions of the rule.
+func (r Rule) matches(v Visit, platform string, lang string) bool {
+	if r.Platform != "" && r.Platform != platform {
+		return false
+	}
+	if r.Country != "" && !strings.EqualFold(r.Country, v.Country) {
+		return false
+	}
+	if r.Language != "" {
+		want := canonicalLanguage(r.Language)
+		if lang != want && !strings.HasPrefix(lang, want+"-") {
+			return false
+		}
+	}
+	for k, want := range r.Query {
+		if v.Query.Get(k) != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Platform returns the platform of the device the User-Agent header belongs to.
+func Platform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	// Android goes first, its user agents often mention Linux too.
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return PlatformIOS
+	case strings.Contains(ua, "windows"):
+		return PlatformWindows
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		return PlatformMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return PlatformLinux
+	}
+
+	return PlatformOther
+}
+
+// preferredLanguage returns the lower-cased canonical tag of the most preferred
+// language of the Accept-Language header.
+func preferredLanguage(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(tags[0].String())
+}
+
+// canonicalLanguage returns the lower-cased canonical form of the language tag,
+// so that the aliases of a language such as iw and he match each other.
+// The rules stored before Validate canonicalized them can have other forms.
+func canonicalLanguage(tag string) string {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return strings.ToLower(tag)
+	}
+
+	return strings.ToLower(t.String())
+}
+
+// Rules returns the rules of the link with the code in the domain.
+func (e Engine) Rules(ctx context.Context, d Domain, code string) (Rules, error) {
+	const sql = `SELECT rules FROM urls WHERE domain_id = $1 AND code_id = $2`
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs Rules
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, codeID).Scan(&rs); err != nil {
+		return nil, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return rs, nil
+}
+
+// SetRules replaces the rules of the link with the code in the domain. The rules of
+// a shared link would redirect the others shortening the same URL, so they are refused.
+func (e Engine) SetRules(ctx context.Context, d Domain, code string, rs Rules) error {
+	const sql = `WITH link AS (SELECT id, shared FROM urls WHERE domain_id = $1 AND code_id = $2),
+					updated AS (UPDATE urls SET rules = $3 FROM link WHERE urls.id = link.id AND NOT link.shared)
+				SELECT shared FROM link`
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return err
+	}
+
+	if err := rs.Validate(d); err != nil {
+		return err
+	}
+
+	var shared bool
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, codeID, rs).Scan(&shared); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+	if shared {
+		return SharedErr
+	}
+
+	return nil
+}
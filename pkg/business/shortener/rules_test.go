@@ -0,0 +1,78 @@
+package shortener_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestRules_Match(t *testing.T) {
+	t.Parallel()
+
+	const (
+		iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+		android = "Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36 Chrome/103.0 Mobile Safari/537.36"
+		desktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/103.0 Safari/537.36"
+		web     = "https://www.testurl.com/app"
+	)
+
+	rules := shortener.Rules{
+		{Platform: shortener.PlatformIOS, URL: "https://apps.apple.com/app/id1"},
+		{Platform: shortener.PlatformAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+		{Query: map[string]string{"campaign": "summer"}, URL: "https://www.testurl.com/summer"},
+		{Language: "de", URL: "https://www.testurl.com/de/app"},
+		{Language: "iw", URL: "https://www.testurl.com/he/app"},
+		{Country: "CH", URL: "https://www.testurl.com/ch/app"},
+	}
+
+	tests := []struct {
+		name  string
+		visit shortener.Visit
+		exp   string
+	}{
+		{"ios", shortener.Visit{UserAgent: iPhone, AcceptLanguage: "de"}, "https://apps.apple.com/app/id1"},
+		{"android", shortener.Visit{UserAgent: android}, "https://play.google.com/store/apps/details?id=app"},
+		{"query", shortener.Visit{UserAgent: desktop, Query: url.Values{"campaign": {"summer"}}}, "https://www.testurl.com/summer"},
+		{"language region", shortener.Visit{UserAgent: desktop, AcceptLanguage: "de-CH,de;q=0.9,en;q=0.8"}, "https://www.testurl.com/de/app"},
+		{"language alias", shortener.Visit{UserAgent: desktop, AcceptLanguage: "he-IL"}, "https://www.testurl.com/he/app"},
+		{"preferred language", shortener.Visit{UserAgent: desktop, AcceptLanguage: "fr,de;q=0.9"}, web},
+		{"country", shortener.Visit{UserAgent: desktop, Country: "ch"}, "https://www.testurl.com/ch/app"},
+		{"no match", shortener.Visit{UserAgent: desktop}, web},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := rules.Match(tt.visit)
+			if !ok {
+				got = web
+			}
+			assert.Equal(t, tt.exp, got)
+		})
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	t.Parallel()
+
+	domain := shortener.Domain{AllowedDomains: []string{"testurl.com"}}
+
+	assert.NoError(t, shortener.Rules{{Platform: shortener.PlatformIOS, URL: "https://www.testurl.com/ios"}}.Validate(domain))
+	assert.Error(t, shortener.Rules{{URL: "/relative"}}.Validate(domain))
+	assert.Error(t, shortener.Rules{{Platform: "symbian", URL: "https://www.testurl.com"}}.Validate(domain))
+	assert.Error(t, shortener.Rules{{Country: "CHE", URL: "https://www.testurl.com"}}.Validate(domain))
+
+	err := shortener.Rules{{URL: "https://www.example.com"}}.Validate(domain)
+	assert.True(t, errors.Is(err, shortener.ForbiddenErr))
+
+	rules := shortener.Rules{{Language: "EN_us", URL: "https://www.testurl.com/en"}, {Language: "iw", URL: "https://www.testurl.com/he"}}
+	assert.NoError(t, rules.Validate(domain))
+	assert.Equal(t, "en-US", rules[0].Language)
+	assert.Equal(t, "he", rules[1].Language)
+}
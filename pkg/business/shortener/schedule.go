@@ -0,0 +1,104 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// NotStartedErr is returned for the links opened before their activation window.
+var NotStartedErr = errors.New("link is not active yet")
+
+// Schedule is the activation window of a link. The link works from NotBefore
+// until NotAfter, a nil bound leaves the window open on its side.
+type Schedule struct {
+	NotBefore *time.Time `db:"not_before"`
+	NotAfter  *time.Time `db:"not_after"`
+
+	// SoonURL is the "coming soon" page the visitors are sent to before the window.
+	SoonURL string `db:"soon_url"`
+
+	// EndedURL is the "campaign ended" page the visitors are sent to after the window.
+	EndedURL string `db:"ended_url"`
+}
+
+// WindowErr is returned for the links opened outside of their activation window.
+// It wraps NotStartedErr or ExpiredErr and carries the URL of the window's page.
+type WindowErr struct {
+	Err error
+
+	// URL is the page to send the visitors to, it is empty if the link has none.
+	URL string
+}
+
+func (e *WindowErr) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WindowErr) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that the window is not empty and that the pages are absolute
+// http(s) URLs which have the bounds of their windows.
+func (s Schedule) Validate() error {
+	switch {
+	case s.NotBefore != nil && s.NotAfter != nil && !s.NotBefore.Before(*s.NotAfter):
+		return errors.New("not_before must be before not_after")
+	case s.SoonURL != "" && s.NotBefore == nil:
+		return errors.New("soon_url needs not_before")
+	case s.EndedURL != "" && s.NotAfter == nil:
+		return errors.New("ended_url needs not_after")
+	case s.SoonURL != "" && !webURL(s.SoonURL):
+		return errors.New("soon_url must be an absolute http(s) URL")
+	case s.EndedURL != "" && !webURL(s.EndedURL):
+		return errors.New("ended_url must be an absolute http(s) URL")
+	}
+
+	return nil
+}
+
+// Allowed returns ForbiddenErr if the domain's policy does not allow the pages.
+func (s Schedule) Allowed(d Domain) error {
+	if s.SoonURL != "" && !d.Allows(Host(s.SoonURL)) {
+		return fmt.Errorf("soon_url: %w", ForbiddenErr)
+	}
+	if s.EndedURL != "" && !d.Allows(Host(s.EndedURL)) {
+		return fmt.Errorf("ended_url: %w", ForbiddenErr)
+	}
+
+	return nil
+}
+
+// webURL reports whether the URL is an absolute http or https URL.
+func webURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Check returns a WindowErr if the link can not be opened at the time.
+func (s Schedule) Check(now time.Time) error {
+	switch {
+	case s.NotBefore != nil && now.Before(*s.NotBefore):
+		return &WindowErr{Err: NotStartedErr, URL: s.SoonURL}
+	case s.NotAfter != nil && !now.Before(*s.NotAfter):
+		return &WindowErr{Err: ExpiredErr, URL: s.EndedURL}
+	}
+
+	return nil
+}
+
+// utc returns the schedule with its bounds in UTC, the way they are stored.
+func (s Schedule) utc() Schedule {
+	if s.NotBefore != nil {
+		t := s.NotBefore.UTC()
+		s.NotBefore = &t
+	}
+	if s.NotAfter != nil {
+		t := s.NotAfter.UTC()
+		s.NotAfter = &t
+	}
+
+	return s
+}
@@ -0,0 +1,86 @@
+package shortener_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestSchedule_Check(t *testing.T) {
+	t.Parallel()
+
+	launch := time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+	end := launch.Add(7 * 24 * time.Hour)
+	campaign := shortener.Schedule{
+		NotBefore: &launch,
+		NotAfter:  &end,
+		SoonURL:   "https://www.testurl.com/soon",
+		EndedURL:  "https://www.testurl.com/ended",
+	}
+
+	tests := []struct {
+		name     string
+		schedule shortener.Schedule
+		now      time.Time
+		expErr   error
+		expURL   string
+	}{
+		{"no window", shortener.Schedule{}, launch, nil, ""},
+		{"before the window", campaign, launch.Add(-time.Second), shortener.NotStartedErr, campaign.SoonURL},
+		{"at the start", campaign, launch, nil, ""},
+		{"at the end", campaign, end, shortener.ExpiredErr, campaign.EndedURL},
+		{"after the window without a page", shortener.Schedule{NotAfter: &end}, end.Add(time.Hour), shortener.ExpiredErr, ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.schedule.Check(tt.now)
+			if tt.expErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.expErr)
+			var windowErr *shortener.WindowErr
+			if assert.True(t, errors.As(err, &windowErr)) {
+				assert.Equal(t, tt.expURL, windowErr.URL)
+			}
+		})
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	assert.NoError(t, shortener.Schedule{NotBefore: &now, NotAfter: &later}.Validate())
+	assert.Error(t, shortener.Schedule{NotBefore: &later, NotAfter: &now}.Validate())
+	assert.Error(t, shortener.Schedule{SoonURL: "https://www.testurl.com/soon"}.Validate())
+	assert.Error(t, shortener.Schedule{EndedURL: "https://www.testurl.com/ended"}.Validate())
+
+	assert.NoError(t, shortener.Schedule{NotBefore: &now, SoonURL: "http://www.testurl.com/soon"}.Validate())
+	assert.Error(t, shortener.Schedule{NotBefore: &now, SoonURL: "/soon"}.Validate())
+	assert.Error(t, shortener.Schedule{NotBefore: &now, SoonURL: "javascript://www.testurl.com/%0Aalert(1)"}.Validate())
+	assert.Error(t, shortener.Schedule{NotAfter: &later, EndedURL: "www.testurl.com/ended"}.Validate())
+}
+
+func TestSchedule_Allowed(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	d := shortener.Domain{AllowedDomains: []string{"testurl.com"}}
+
+	assert.NoError(t, shortener.Schedule{NotBefore: &now, SoonURL: "https://www.testurl.com/soon"}.Allowed(d))
+	assert.ErrorIs(t, shortener.Schedule{NotBefore: &now, SoonURL: "https://evil.example/soon"}.Allowed(d), shortener.ForbiddenErr)
+	assert.ErrorIs(t, shortener.Schedule{NotAfter: &now, EndedURL: "https://evil.example/ended"}.Allowed(d), shortener.ForbiddenErr)
+	assert.NoError(t, shortener.Schedule{NotAfter: &now, EndedURL: "https://evil.example/ended"}.Allowed(shortener.Domain{}))
+}
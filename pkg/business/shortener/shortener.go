@@ -4,62 +4,548 @@ package shortener
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/jxskiss/base62"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// EncShift is added to URL's id before encoding it to BASE62.
+// EncShift is added to URL's code id before encoding it to BASE62.
 const EncShift = 1024 * 1024
 
 var (
-	DecodeErr   = errors.New("code is incorrect")
-	EncShiftErr = errors.New("code is less than encoding shift")
+	DecodeErr    = errors.New("code is incorrect")
+	EncShiftErr  = fmt.Errorf("%w: less than encoding shift", DecodeErr)
+	ForbiddenErr = errors.New("destination domain is not allowed")
+	SharedErr    = errors.New("link is shared with the others shortening its URL")
+	ExpiredErr   = errors.New("link has expired")
+	DisabledErr  = errors.New("link is disabled")
+	ExhaustedErr = errors.New("link has no clicks left")
+
+	PasswordRequiredErr = errors.New("link is protected by a password")
+	PasswordErr         = errors.New("password is incorrect")
+	RateLimitedErr      = errors.New("too many failed password attempts")
 )
 
+// tracer traces the operations of the engine with the global tracer provider.
+var tracer = otel.Tracer("github.com/illyasch/url-shortener/pkg/business/shortener")
+
 // Engine contains the database for storing URLs.
 type Engine struct {
 	DB *sqlx.DB
+
+	attempts *attempts
 }
 
 // New constructs a new Engine.
 func New(db *sqlx.DB) Engine {
-	return Engine{DB: db}
+	return Engine{DB: db, attempts: newAttempts()}
+}
+
+// NewLink contains the information needed to shorten a URL.
+type NewLink struct {
+	URL   string
+	Owner string
+	Tags  []string
+
+	// Schedule limits the time the link works in.
+	Schedule Schedule
+
+	// Password protects the link when it is not empty.
+	Password string
+
+	// MaxClicks is the number of times the link can be opened, zero value means unlimited.
+	MaxClicks int64
+
+	Passthrough Passthrough
+
+	// UTM overrides the UTM parameters of the domain, UTMDisabled turns the tagging off.
+	UTM         UTM
+	UTMDisabled bool
+
+	// Warn is the way the link shows the interstitial page.
+	Warn Warn
+}
+
+// shared reports whether the link is a plain one which can be given to
+// everyone shortening the same URL. The links with an owner or tags are not
+// shared, so they are not handed to other owners and the filters find them.
+func (nl NewLink) shared() bool {
+	return nl.Owner == "" && len(nl.Tags) == 0 && nl.Schedule == (Schedule{}) && nl.Password == "" &&
+		nl.MaxClicks == 0 && !nl.Passthrough.Enabled && nl.UTM == (UTM{}) && !nl.UTMDisabled && nl.Warn == WarnDomain
+}
+
+// Limits of the new links.
+const (
+	// MinURLLen is the length of the shortest URL to shorten.
+	MinURLLen = 9
+
+	// MaxPasswordLen is the longest password bcrypt hashes.
+	MaxPasswordLen = 72
+)
+
+// Validate checks the new link before it is shortened.
+func (nl NewLink) Validate() error {
+	if len(nl.URL) < MinURLLen {
+		return errors.New("input URL is incorrect")
+	}
+	if _, err := ParseTemplate(nl.URL); err != nil {
+		return err
+	}
+	if err := nl.Schedule.Validate(); err != nil {
+		return err
+	}
+	if nl.MaxClicks < 0 {
+		return errors.New("max_clicks must be a positive integer")
+	}
+	if err := nl.Passthrough.Validate(); err != nil {
+		return err
+	}
+	if err := nl.Warn.Validate(); err != nil {
+		return err
+	}
+	if len(nl.Password) > MaxPasswordLen {
+		return fmt.Errorf("password must be at most %d bytes long", MaxPasswordLen)
+	}
+
+	return nil
+}
+
+// Visit contains the information the visitor opening a link provides.
+type Visit struct {
+	Password string
+
+	// UserAgent, AcceptLanguage, Country and Query are matched by the rules of the link.
+	UserAgent      string
+	AcceptLanguage string
+	Country        string
+	Query          url.Values
+
+	// Path is the escaped extra path after the code, it is passed through to the destination.
+	Path string
+
+	// Variant is the variant of the split link the visitor was served before.
+	Variant string
+}
+
+// Link is a shortened URL stored in the database.
+type Link struct {
+	ID          int64          `db:"id"`
+	CodeID      int64          `db:"code_id"`
+	Domain      string         `db:"domain"`
+	URL         string         `db:"url"`
+	Owner       string         `db:"owner"`
+	Tags        pq.StringArray `db:"tags"`
+	Clicks      int64          `db:"clicks"`
+	Disabled    bool           `db:"disabled"`
+	DateCreated time.Time      `db:"date_created"`
+
+	Schedule
+
+	PasswordHash string `db:"password_hash"`
+
+	// ClicksLeft is the number of times the link can still be opened, nil means unlimited.
+	ClicksLeft *int64 `db:"clicks_left"`
+
+	// UTM are the link's own UTM parameters, UTMDisabled turns the tagging off.
+	UTMDisabled bool `db:"utm_disabled"`
+	UTM
+
+	Passthrough
+
+	// Warn is the way the link shows the interstitial page, Flagged is set when the link was flagged
+	// as unsafe.
+	Warn    Warn `db:"warn"`
+	Flagged bool `db:"flagged"`
+}
+
+// Protected reports whether the link is protected by a password.
+func (l Link) Protected() bool {
+	return l.PasswordHash != ""
+}
+
+// Redacted returns the link without its destinations when it is protected by a password,
+// so they are only given to the visitors opening it with the password.
+func (l Link) Redacted() Link {
+	if l.Protected() {
+		l.URL, l.SoonURL, l.EndedURL = "", "", ""
+	}
+
+	return l
+}
+
+// Check returns DisabledErr, a WindowErr or ExhaustedErr if the link can not be opened now.
+func (l Link) Check(now time.Time) error {
+	if l.Disabled {
+		return DisabledErr
+	}
+	if err := l.Schedule.Check(now); err != nil {
+		return err
+	}
+	if l.ClicksLeft != nil && *l.ClicksLeft <= 0 {
+		return ExhaustedErr
+	}
+
+	return nil
+}
+
+// Code returns the BASE62 code of the link in its domain.
+func (l Link) Code() string {
+	return Encode(l.CodeID)
+}
+
+// Shorten saves a URL to the database and returns its code in the domain encoded to BASE62 string.
+// Shortening a plain URL which the domain already has returns the code of the existing link.
+func (e Engine) Shorten(ctx context.Context, d Domain, nl NewLink) (code string, err error) {
+	const (
+		lockSQL   = `SELECT id FROM domains WHERE id = $1 FOR UPDATE`
+		touchSQL  = `UPDATE urls SET date_created = NOW() WHERE domain_id = $1 AND url = $2 AND shared RETURNING code_id`
+		nextSQL   = `UPDATE domains SET last_code = last_code + 1 WHERE id = $1 RETURNING last_code`
+		insertSQL = `INSERT INTO urls(domain_id, code_id, url, owner, host, tags, not_before, not_after, soon_url,
+							ended_url, password_hash, clicks_left, passthrough, query_conflict, utm_source, utm_medium,
+							utm_campaign, utm_disabled, warn, shared, date_created)
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+							NOW())`
+	)
+
+	ctx, span := tracer.Start(ctx, "shortener.Shorten", trace.WithAttributes(attribute.String("shortener.domain", d.Name)))
+	defer func() {
+		span.SetAttributes(attribute.String("shortener.code", code))
+		endSpan(span, err)
+	}()
+
+	host := Host(nl.URL)
+	if !d.Allows(host) {
+		return "", ForbiddenErr
+	}
+
+	if _, err := ParseTemplate(nl.URL); err != nil {
+		return "", err
+	}
+
+	if err := nl.Schedule.Validate(); err != nil {
+		return "", err
+	}
+	if err := nl.Schedule.Allowed(d); err != nil {
+		return "", err
+	}
+	if err := nl.Passthrough.Validate(); err != nil {
+		return "", err
+	}
+	if err := nl.Warn.Validate(); err != nil {
+		return "", err
+	}
+	queryConflict := nl.Passthrough.QueryConflict
+	if queryConflict == "" {
+		queryConflict = QueryKeep
+	}
+	schedule := nl.Schedule.utc()
+
+	tags := nl.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var clicksLeft *int64
+	if nl.MaxClicks > 0 {
+		clicksLeft = &nl.MaxClicks
+	}
+
+	var passwordHash string
+	if nl.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(nl.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", fmt.Errorf("hash password: %w", err)
+		}
+		passwordHash = string(hash)
+	}
+
+	tx, err := e.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Locking the domain serializes the shortening within the domain, so the
+	// same URL can not be given two codes.
+	var id int64
+	if err := tx.QueryRowxContext(ctx, lockSQL, d.ID).Scan(&id); err != nil {
+		return "", fmt.Errorf("query %s: %w", lockSQL, err)
+	}
+
+	var codeID int64
+	if nl.shared() {
+		err = tx.QueryRowxContext(ctx, touchSQL, d.ID, nl.URL).Scan(&codeID)
+		switch {
+		case err == nil:
+			return Encode(codeID), tx.Commit()
+
+		case !errors.Is(err, sql.ErrNoRows):
+			return "", fmt.Errorf("query %s: %w", touchSQL, err)
+		}
+	}
+
+	if err := tx.QueryRowxContext(ctx, nextSQL, d.ID).Scan(&codeID); err != nil {
+		return "", fmt.Errorf("query %s: %w", nextSQL, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, insertSQL, d.ID, codeID, nl.URL, nl.Owner, host, pq.Array(tags), schedule.NotBefore, schedule.NotAfter,
+		schedule.SoonURL, schedule.EndedURL, passwordHash, clicksLeft, nl.Passthrough.Enabled, queryConflict,
+		nl.UTM.Source, nl.UTM.Medium, nl.UTM.Campaign, nl.UTMDisabled, nl.Warn, nl.shared()); err != nil {
+		return "", fmt.Errorf("query %s: %w", insertSQL, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return Encode(codeID), nil
 }
 
-// Shorten saves a URL to the database and returns its id encoded to BASE62 string.
-func (e Engine) Shorten(ctx context.Context, url string) (string, error) {
-	const sql = `INSERT INTO urls(url, date_created) VALUES ($1, NOW()) 
-                	ON CONFLICT(url) DO UPDATE SET date_created = NOW() RETURNING id`
+// Expand takes the BASE62 code, decodes it and finds a corresponding URL of the domain in the database.
+// Every successful expanding counts a click of the link. Disabled links return DisabledErr and the links
+// opened outside of their schedule return a WindowErr. The links protected by a password are expanded
+// only with the correct password in the visit. After MaxPasswordAttempts failed attempts in a row the
+// link returns RateLimitedErr until PasswordAttemptsWindow is over.
+//
+// The visitor is sent to the URL of the first rule of the link matching the visit or, if none matches,
+// to a variant of the split link or to the link's URL with its placeholders filled from the visit. The
+// links passing paths through append the extra path and the query of the visit to the destination, the
+// others return PassthroughErr for an extra path. The UTM parameters of the link and of the domain are
+// added to the destination unless the link opts out. The destination tells whether the visitor should
+// be warned on the interstitial page before going there.
+//
+// The links with limited clicks return ExhaustedErr when they have no clicks left. The click is taken
+// by a conditional update in the database, so concurrent visitors can not open a link more times than
+// it allows. The update always reads the current row, nothing is served from a cache. Every click is
+// recorded with the variant it was served.
+func (e Engine) Expand(ctx context.Context, d Domain, code string, v Visit) (_ Destination, err error) {
+	const (
+		selectSQL = `SELECT id, url, disabled, not_before, not_after, soon_url, ended_url,
+						COALESCE(clicks_left <= 0, false) AS exhausted, password_hash, rules, split, passthrough,
+						query_conflict, utm_source, utm_medium, utm_campaign, utm_disabled, warn, flagged
+						FROM urls WHERE domain_id = $1 AND code_id = $2`
+		clickSQL = `WITH u AS (
+						UPDATE urls SET clicks = clicks + 1, clicks_left = clicks_left - 1
+						WHERE id = $1 AND (clicks_left IS NULL OR clicks_left > 0) RETURNING id
+					)
+					INSERT INTO clicks(url_id, variant, date_created) SELECT id, $2, NOW() FROM u RETURNING url_id`
+	)
+
+	ctx, span := tracer.Start(ctx, "shortener.Expand", trace.WithAttributes(
+		attribute.String("shortener.domain", d.Name),
+		attribute.String("shortener.code", code),
+	))
+	defer func() { endSpan(span, err) }()
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return Destination{}, err
+	}
+
+	var l expandLink
+	if err := e.DB.GetContext(ctx, &l, selectSQL, d.ID, codeID); err != nil {
+		return Destination{}, fmt.Errorf("query %s: %w", selectSQL, err)
+	}
+
+	if l.Disabled {
+		return Destination{}, DisabledErr
+	}
+	if err := l.Schedule.Check(time.Now()); err != nil {
+		return Destination{}, err
+	}
+	if l.Exhausted {
+		return Destination{}, ExhaustedErr
+	}
+
+	if l.PasswordHash != "" {
+		if err := e.checkPassword(l.ID, l.PasswordHash, v.Password); err != nil {
+			return Destination{}, err
+		}
+	}
+
+	dest, extraPath, err := l.destination(v)
+	if err != nil {
+		return Destination{}, err
+	}
+	if dest.URL, err = l.Passthrough.Apply(dest.URL, extraPath, v.Query); err != nil {
+		return Destination{}, err
+	}
+	if !l.UTMDisabled {
+		if dest.URL, err = l.UTM.Or(d.UTM).Apply(dest.URL); err != nil {
+			return Destination{}, err
+		}
+	}
+	dest.Warning = warning(d, l.Warn, l.Flagged, Host(dest.URL))
 
+	// The last clicks may have been taken by concurrent visitors since the select.
 	var id int64
-	err := e.DB.QueryRowxContext(ctx, sql, url).Scan(&id)
+	err = e.DB.QueryRowxContext(ctx, clickSQL, l.ID, dest.Variant).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Destination{}, ExhaustedErr
+	case err != nil:
+		return Destination{}, fmt.Errorf("query %s: %w", clickSQL, err)
+	}
+
+	return dest, nil
+}
+
+// expandLink is the part of a link Expand needs.
+type expandLink struct {
+	ID           int64  `db:"id"`
+	URL          string `db:"url"`
+	Disabled     bool   `db:"disabled"`
+	Exhausted    bool   `db:"exhausted"`
+	PasswordHash string `db:"password_hash"`
+	Rules        Rules  `db:"rules"`
+	Split        Split  `db:"split"`
+	UTMDisabled  bool   `db:"utm_disabled"`
+	Warn         Warn   `db:"warn"`
+	Flagged      bool   `db:"flagged"`
+	Schedule
+	Passthrough
+	UTM
+}
+
+// destination chooses where to send the visitor: to the URL of the first matching rule, to a variant
+// of the split or to the link's URL filled in as a template. It returns the extra path of the visit
+// which is left for passing through.
+func (l expandLink) destination(v Visit) (Destination, string, error) {
+	if u, ok := l.Rules.Match(v); ok {
+		return Destination{URL: u}, v.Path, nil
+	}
+	if variant, ok := l.Split.Pick(v.Variant); ok {
+		return Destination{URL: variant.URL, Variant: variant.Name, Sticky: l.Split.Sticky}, v.Path, nil
+	}
+
+	t, err := ParseTemplate(l.URL)
 	if err != nil {
-		return "", fmt.Errorf("query %s: %w", sql, err)
+		return Destination{}, "", fmt.Errorf("parse template: %w", err)
 	}
 
-	return Encode(id), nil
+	// The path segments after the code fill the template's placeholders when it has them.
+	path, extraPath := "", v.Path
+	if t.Segments() > 0 {
+		path, extraPath = v.Path, ""
+	}
+
+	u, err := t.Fill(path, v.Query)
+	if err != nil {
+		return Destination{}, "", err
+	}
+
+	return Destination{URL: u}, extraPath, nil
+}
+
+// checkPassword compares the password with the hash of the link's password
+// and counts the failed attempts.
+func (e Engine) checkPassword(id int64, hash string, password string) error {
+	now := time.Now()
+	if password == "" {
+		if e.attempts.blocked(id, now) {
+			return RateLimitedErr
+		}
+		return PasswordRequiredErr
+	}
+
+	if !e.attempts.reserve(id, now) {
+		return RateLimitedErr
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return PasswordErr
+	}
+	e.attempts.release(id)
+
+	return nil
+}
+
+// Link finds the link with the code in the domain without counting a click.
+func (e Engine) Link(ctx context.Context, d Domain, code string) (Link, error) {
+	const sql = `SELECT u.id, u.code_id, d.name AS domain, u.url, u.owner, u.tags, u.clicks, u.not_before,
+					u.not_after, u.soon_url, u.ended_url, u.disabled, u.date_created, u.password_hash, u.clicks_left,
+					u.passthrough, u.query_conflict, u.utm_source, u.utm_medium, u.utm_campaign, u.utm_disabled,
+					u.warn, u.flagged
+				FROM urls u JOIN domains d ON d.id = u.domain_id WHERE u.domain_id = $1 AND u.code_id = $2`
+
+	id, err := Decode(code)
+	if err != nil {
+		return Link{}, err
+	}
+
+	var l Link
+	if err := e.DB.GetContext(ctx, &l, sql, d.ID, id); err != nil {
+		return Link{}, fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return l, nil
 }
 
-// Expand takes the BASE62 code, decodes it and finds a corresponding URL in the database.
-func (e Engine) Expand(ctx context.Context, code string) (string, error) {
-	const sql = `SELECT url FROM urls WHERE id = $1`
+// SetDisabled disables or enables the link with the code in the domain.
+// A disabled link is not shared anymore, shortening its URL again makes a new link.
+func (e Engine) SetDisabled(ctx context.Context, d Domain, code string, disabled bool) error {
+	const sql = `UPDATE urls SET disabled = $3, shared = shared AND NOT $3
+					WHERE domain_id = $1 AND code_id = $2 RETURNING code_id`
 
 	id, err := Decode(code)
 	if err != nil {
-		return "", DecodeErr
+		return err
 	}
 
-	var url string
-	err = e.DB.QueryRowxContext(ctx, sql, id).Scan(&url)
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, id, disabled).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
+
+// Delete removes the link with the code in the domain together with its clicks.
+// The codes are issued by the counter of the domain, so the code is never reused.
+func (e Engine) Delete(ctx context.Context, d Domain, code string) error {
+	const sql = `DELETE FROM urls WHERE domain_id = $1 AND code_id = $2 RETURNING code_id`
+
+	id, err := Decode(code)
+	if err != nil {
+		return err
+	}
+
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, id).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
+
+// endSpan records the error of the operation on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Host returns the lower-cased host name of a URL or an empty string
+// if the URL can not be parsed.
+func Host(rawURL string) string {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("query %s: %w", sql, err)
+		return ""
 	}
 
-	return url, nil
+	return strings.ToLower(u.Hostname())
 }
 
 func Encode(id int64) string {
@@ -69,12 +555,12 @@ func Encode(id int64) string {
 func Decode(code string) (int64, error) {
 	bb, err := base62.DecodeString(code)
 	if err != nil {
-		return 0, fmt.Errorf("base62.Decode(%s): %w", code, err)
+		return 0, fmt.Errorf("%w: base62.Decode(%s): %v", DecodeErr, code, err)
 	}
 
 	id, err := base62.ParseInt(bb)
 	if err != nil {
-		return 0, fmt.Errorf("base62.ParseUint: %w", err)
+		return 0, fmt.Errorf("%w: base62.ParseUint: %v", DecodeErr, err)
 	}
 
 	if id <= EncShift {
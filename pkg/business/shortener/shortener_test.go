@@ -0,0 +1,57 @@
+package shortener_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestNewLink_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := shortener.NewLink{URL: "https://www.testurl.com/"}
+	with := func(change func(*shortener.NewLink)) shortener.NewLink {
+		nl := valid
+		change(&nl)
+		return nl
+	}
+
+	tests := []struct {
+		name  string
+		link  shortener.NewLink
+		valid bool
+	}{
+		{"plain link", valid, true},
+		{"all options", with(func(nl *shortener.NewLink) {
+			nl.MaxClicks = 3
+			nl.Password = "s3cret"
+			nl.Passthrough = shortener.Passthrough{Enabled: true, QueryConflict: shortener.QueryAppend}
+			nl.Warn = shortener.WarnAlways
+		}), true},
+		{"short URL", with(func(nl *shortener.NewLink) { nl.URL = "http://a" }), false},
+		{"broken template", with(func(nl *shortener.NewLink) { nl.URL = "https://{host}.testurl.com/" }), false},
+		{"negative max clicks", with(func(nl *shortener.NewLink) { nl.MaxClicks = -1 }), false},
+		{"unknown query conflict", with(func(nl *shortener.NewLink) { nl.Passthrough.QueryConflict = "merge" }), false},
+		{"unknown warn", with(func(nl *shortener.NewLink) { nl.Warn = "sometimes" }), false},
+		{"long password", with(func(nl *shortener.NewLink) {
+			nl.Password = strings.Repeat("a", shortener.MaxPasswordLen+1)
+		}), false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.link.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package shortener
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// MaxVariants is the most variants a link can be split into.
+const MaxVariants = 16
+
+// variantName is the format of the variant names, they are stored in cookies.
+var variantName = regexp.MustCompile(`^[0-9A-Za-z_-]{1,32}$`)
+
+// random picks the variants. The global source of math/rand is not seeded
+// before Go 1.20, so every process would serve the same sequence.
+var random = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Variant is one of the destinations of a split link.
+type Variant struct {
+	Name string `json:"name"`
+
+	// URL is left out of the variants of the links protected by a password, see Redacted.
+	URL string `json:"url,omitempty"`
+
+	// Weight is the share of the visitors the variant gets relative to the
+	// other variants. The variants with zero weight are paused.
+	Weight int `json:"weight"`
+}
+
+// Split spreads the visitors of a link over the variants by their weights.
+type Split struct {
+	Variants []Variant `json:"variants"`
+
+	// Sticky keeps returning visitors on the variant they were served first.
+	Sticky bool `json:"sticky"`
+}
+
+// Redacted returns a copy of the split without the URLs of its variants for the links
+// protected by a password.
+func (s Split) Redacted() Split {
+	variants := make([]Variant, len(s.Variants))
+	for i, v := range s.Variants {
+		v.URL = ""
+		variants[i] = v
+	}
+	s.Variants = variants
+
+	return s
+}
+
+// Destination is where the visitor of a link is sent.
+type Destination struct {
+	URL string
+
+	// Variant is the name of the variant of a split link the visitor got.
+	Variant string
+
+	// Sticky reports whether the visitor should be remembered on the variant.
+	Sticky bool
+
+	// Warning is one of the Warning constants when the visitor should be
+	// shown the interstitial page before going to the URL.
+	Warning string
+}
+
+// Value implements driver.Valuer.
+func (s Split) Value() (driver.Value, error) {
+	if s.Variants == nil {
+		s.Variants = []Variant{}
+	}
+
+	return jsonValue(s)
+}
+
+// Scan implements sql.Scanner.
+func (s *Split) Scan(src any) error {
+	return jsonScan(src, s)
+}
+
+// Validate checks the variants and that the domain allows their destinations.
+func (s Split) Validate(d Domain) error {
+	if len(s.Variants) > MaxVariants {
+		return fmt.Errorf("link can have at most %d variants", MaxVariants)
+	}
+
+	total := 0
+	names := map[string]bool{}
+	for i, v := range s.Variants {
+		if !variantName.MatchString(v.Name) {
+			return fmt.Errorf("variant %d: name must be 1 to 32 letters, digits, - or _", i+1)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("variant %d: name %q is repeated", i+1, v.Name)
+		}
+		names[v.Name] = true
+
+		u, err := url.Parse(v.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("variant %d: url must be an absolute URL", i+1)
+		}
+		if !d.Allows(Host(v.URL)) {
+			return fmt.Errorf("variant %d: %w", i+1, ForbiddenErr)
+		}
+
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %d: weight must not be negative", i+1)
+		}
+		total += v.Weight
+	}
+
+	if len(s.Variants) > 0 && total == 0 {
+		return errors.New("at least one variant must have a weight")
+	}
+
+	return nil
+}
+
+// Pick chooses the variant for the visitor. The sticky split keeps the visitor
+// on the variant named by sticky while the variant is not paused, the others
+// are chosen by weighted random choice.
+func (s Split) Pick(sticky string) (Variant, bool) {
+	total := 0
+	for _, v := range s.Variants {
+		if s.Sticky && sticky != "" && v.Name == sticky && v.Weight > 0 {
+			return v, true
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return Variant{}, false
+	}
+
+	random.Lock()
+	n := random.Intn(total)
+	random.Unlock()
+
+	for _, v := range s.Variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+
+	return Variant{}, false
+}
+
+// Split returns the variants of the link with the code in the domain.
+func (e Engine) Split(ctx context.Context, d Domain, code string) (Split, error) {
+	const sql = `SELECT split FROM urls WHERE domain_id = $1 AND code_id = $2`
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return Split{}, err
+	}
+
+	var s Split
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, codeID).Scan(&s); err != nil {
+		return Split{}, fmt.Errorf("query %s: %w", sql, err)
+	}
+	if s.Variants == nil {
+		s.Variants = []Variant{}
+	}
+
+	return s, nil
+}
+
+// SetSplit replaces the variants of the link with the code in the domain. The variants
+// of a shared link would take the visitors of the others shortening the same URL, so
+// they are refused.
+func (e Engine) SetSplit(ctx context.Context, d Domain, code string, s Split) error {
+	const sql = `WITH link AS (SELECT id, shared FROM urls WHERE domain_id = $1 AND code_id = $2),
+					updated AS (UPDATE urls SET split = $3 FROM link WHERE urls.id = link.id AND NOT link.shared)
+				SELECT shared FROM link`
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Validate(d); err != nil {
+		return err
+	}
+
+	var shared bool
+	if err := e.DB.QueryRowxContext(ctx, sql, d.ID, codeID, s).Scan(&shared); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+	if shared {
+		return SharedErr
+	}
+
+	return nil
+}
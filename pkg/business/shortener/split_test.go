@@ -0,0 +1,74 @@
+package shortener_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestSplit_Pick(t *testing.T) {
+	t.Parallel()
+
+	split := shortener.Split{
+		Variants: []shortener.Variant{
+			{Name: "a", URL: "https://www.testurl.com/a", Weight: 3},
+			{Name: "b", URL: "https://www.testurl.com/b", Weight: 1},
+			{Name: "paused", URL: "https://www.testurl.com/paused", Weight: 0},
+		},
+	}
+
+	t.Run("weighted choice", func(t *testing.T) {
+		t.Parallel()
+
+		const picks = 4000
+		count := map[string]int{}
+		for i := 0; i < picks; i++ {
+			v, ok := split.Pick("")
+			assert.True(t, ok)
+			count[v.Name]++
+		}
+
+		assert.Zero(t, count["paused"])
+		assert.InDelta(t, picks*3/4, count["a"], picks/20)
+		assert.InDelta(t, picks/4, count["b"], picks/20)
+	})
+
+	t.Run("sticky variant", func(t *testing.T) {
+		t.Parallel()
+
+		sticky := split
+		sticky.Sticky = true
+		for i := 0; i < 100; i++ {
+			v, _ := sticky.Pick("b")
+			assert.Equal(t, "b", v.Name)
+		}
+
+		v, _ := sticky.Pick("paused")
+		assert.NotEqual(t, "paused", v.Name)
+	})
+
+	t.Run("no variants", func(t *testing.T) {
+		t.Parallel()
+
+		_, ok := shortener.Split{}.Pick("")
+		assert.False(t, ok)
+	})
+}
+
+func TestSplit_Validate(t *testing.T) {
+	t.Parallel()
+
+	domain := shortener.Domain{}
+	variant := func(name string, weight int) shortener.Variant {
+		return shortener.Variant{Name: name, URL: "https://www.testurl.com/" + name, Weight: weight}
+	}
+
+	assert.NoError(t, shortener.Split{}.Validate(domain))
+	assert.NoError(t, shortener.Split{Variants: []shortener.Variant{variant("a", 1), variant("b", 0)}}.Validate(domain))
+	assert.Error(t, shortener.Split{Variants: []shortener.Variant{variant("a", 1), variant("a", 1)}}.Validate(domain))
+	assert.Error(t, shortener.Split{Variants: []shortener.Variant{variant("a b", 1)}}.Validate(domain))
+	assert.Error(t, shortener.Split{Variants: []shortener.Variant{variant("a", 0)}}.Validate(domain))
+	assert.Error(t, shortener.Split{Variants: []shortener.Variant{variant("a", -1)}}.Validate(domain))
+}
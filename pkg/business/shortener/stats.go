@@ -0,0 +1,48 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+)
+
+// VariantClicks is the number of clicks a variant was served on.
+type VariantClicks struct {
+	Variant string `db:"variant"`
+	Clicks  int64  `db:"clicks"`
+}
+
+// Stats are the click statistics of a link.
+type Stats struct {
+	Clicks   int64
+	Variants []VariantClicks
+}
+
+// Stats returns the click statistics of the link with the code in the domain.
+// The clicks on the variants of a split link are broken down by variant.
+func (e Engine) Stats(ctx context.Context, d Domain, code string) (Stats, error) {
+	const (
+		linkSQL     = `SELECT id, clicks FROM urls WHERE domain_id = $1 AND code_id = $2`
+		variantsSQL = `SELECT variant, COUNT(*) AS clicks FROM clicks
+							WHERE url_id = $1 AND variant <> '' GROUP BY variant ORDER BY variant`
+	)
+
+	codeID, err := Decode(code)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var (
+		id    int64
+		stats Stats
+	)
+	if err := e.DB.QueryRowxContext(ctx, linkSQL, d.ID, codeID).Scan(&id, &stats.Clicks); err != nil {
+		return Stats{}, fmt.Errorf("query %s: %w", linkSQL, err)
+	}
+
+	stats.Variants = []VariantClicks{}
+	if err := e.DB.SelectContext(ctx, &stats.Variants, variantsSQL, id); err != nil {
+		return Stats{}, fmt.Errorf("query %s: %w", variantsSQL, err)
+	}
+
+	return stats, nil
+}
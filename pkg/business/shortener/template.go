@@ -0,0 +1,200 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TemplateErr is returned when the short URL does not fill the placeholders of the link's template.
+var TemplateErr = errors.New("link parameters are incorrect")
+
+var (
+	// placeholder is {name} or {name|default}, the name is a query parameter
+	// or a 1-based number of a path segment after the code.
+	placeholder = regexp.MustCompile(`\{([A-Za-z_][0-9A-Za-z_]*|[1-9][0-9]*)(\|[^{}]*)?\}`)
+
+	// templateValue are the characters the placeholders can be filled with.
+	templateValue = regexp.MustCompile(`^[0-9A-Za-z._~-]*$`)
+)
+
+// maxTemplateValue is the longest value of a placeholder.
+const maxTemplateValue = 256
+
+// Template is a destination URL with placeholders, e.g.
+// https://shop.example/{sku}?ref={ref|direct}. The placeholders can only be
+// in the path, the query and the fragment, so they can not change the host.
+type Template struct {
+	raw   string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+
+	// The placeholder following the literal, if name is not empty.
+	name       string
+	def        string
+	hasDefault bool
+
+	// inQuery reports whether the placeholder is in the query rather than in the path or the fragment.
+	inQuery bool
+}
+
+// ParseTemplate parses the destination URL. A URL without placeholders is a
+// template which is filled with itself.
+func ParseTemplate(raw string) (Template, error) {
+	t := Template{raw: raw}
+
+	matches := placeholder.FindAllStringSubmatchIndex(raw, -1)
+	if len(matches) == 0 {
+		return t, nil
+	}
+
+	// The placeholders must come after the host, the path starts at the first slash after "//".
+	scheme := strings.Index(raw, "://")
+	if scheme < 0 {
+		return Template{}, errors.New("url template must be an absolute URL")
+	}
+	hostEnd := strings.IndexAny(raw[scheme+3:], "/?#")
+	if hostEnd < 0 || matches[0][0] < scheme+3+hostEnd {
+		return Template{}, errors.New("url template can not have placeholders in the scheme or host")
+	}
+
+	query := strings.Index(raw, "?")
+	fragment := strings.Index(raw, "#")
+
+	last := 0
+	for _, m := range matches {
+		p := templatePart{
+			literal: raw[last:m[0]],
+			name:    raw[m[2]:m[3]],
+		}
+		if m[4] >= 0 {
+			p.def, p.hasDefault = raw[m[4]+1:m[5]], true
+			if !templateValue.MatchString(p.def) {
+				return Template{}, fmt.Errorf("default of {%s} has characters other than letters, digits, ., _, ~ or -", p.name)
+			}
+		}
+		p.inQuery = query >= 0 && m[0] > query && (fragment < 0 || m[0] < fragment)
+
+		t.parts = append(t.parts, p)
+		last = m[1]
+	}
+	t.parts = append(t.parts, templatePart{literal: raw[last:]})
+
+	if strings.ContainsAny(strings.Join(t.literals(), ""), "{}") {
+		return Template{}, errors.New("url has a malformed placeholder")
+	}
+
+	// The template with the placeholders filled must be a valid URL.
+	sample, err := t.fill(func(templatePart) (string, error) { return "x", nil })
+	if err != nil {
+		return Template{}, err
+	}
+	if _, err := url.Parse(sample); err != nil {
+		return Template{}, fmt.Errorf("url template is not a valid URL: %w", err)
+	}
+
+	return t, nil
+}
+
+// IsPlain reports whether the template has no placeholders.
+func (t Template) IsPlain() bool {
+	return len(t.parts) == 0
+}
+
+// Segments returns the number of the path segments after the code the template uses.
+func (t Template) Segments() int {
+	n := 0
+	for _, p := range t.parts {
+		if i, err := strconv.Atoi(p.name); err == nil && i > n {
+			n = i
+		}
+	}
+
+	return n
+}
+
+// Fill substitutes the placeholders with the escaped path segments after the
+// code and the query parameters of the short URL. The missing values are
+// taken from the defaults.
+func (t Template) Fill(escapedPath string, query url.Values) (string, error) {
+	if t.IsPlain() {
+		return t.raw, nil
+	}
+
+	var segments []string
+	if p := strings.Trim(escapedPath, "/"); p != "" {
+		segments = strings.Split(p, "/")
+	}
+	if len(segments) > t.Segments() {
+		return "", fmt.Errorf("%w: too many path segments", TemplateErr)
+	}
+
+	return t.fill(func(p templatePart) (string, error) {
+		var (
+			value string
+			found bool
+		)
+		if i, err := strconv.Atoi(p.name); err == nil {
+			if i <= len(segments) {
+				if value, err = url.PathUnescape(segments[i-1]); err != nil {
+					return "", fmt.Errorf("%w: segment %d: %s", TemplateErr, i, err)
+				}
+				found = true
+			}
+		} else if vs, ok := query[p.name]; ok && len(vs) > 0 {
+			value, found = vs[0], true
+		}
+
+		switch {
+		case !found && p.hasDefault:
+			value = p.def
+		case !found:
+			return "", fmt.Errorf("%w: {%s} is missing", TemplateErr, p.name)
+		case len(value) > maxTemplateValue || !templateValue.MatchString(value):
+			return "", fmt.Errorf("%w: {%s} has characters other than letters, digits, ., _, ~ or -", TemplateErr, p.name)
+		case !p.inQuery && (value == "." || value == ".."):
+			return "", fmt.Errorf("%w: {%s} is a dot segment", TemplateErr, p.name)
+		}
+
+		return value, nil
+	})
+}
+
+// fill joins the literals with the escaped values of the placeholders.
+func (t Template) fill(value func(templatePart) (string, error)) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		b.WriteString(p.literal)
+		if p.name == "" {
+			continue
+		}
+
+		v, err := value(p)
+		if err != nil {
+			return "", err
+		}
+		if p.inQuery {
+			b.WriteString(url.QueryEscape(v))
+		} else {
+			b.WriteString(url.PathEscape(v))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// literals returns the parts of the template around the placeholders.
+func (t Template) literals() []string {
+	literals := make([]string, 0, len(t.parts))
+	for _, p := range t.parts {
+		literals = append(literals, p.literal)
+	}
+
+	return literals
+}
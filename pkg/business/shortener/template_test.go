@@ -0,0 +1,82 @@
+package shortener_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestParseTemplate(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{
+		"https://shop.testurl.com/item",
+		"https://shop.testurl.com/{sku}?ref={ref|direct}",
+		"https://shop.testurl.com/{1}/{2|all}#{section|top}",
+	}
+	for _, raw := range valid {
+		_, err := shortener.ParseTemplate(raw)
+		assert.NoError(t, err, raw)
+	}
+
+	invalid := []string{
+		"https://{shop}.testurl.com/item",
+		"https://shop.testurl.com{path}",
+		"{scheme}://shop.testurl.com/item",
+		"https://shop.testurl.com/{sku}/{",
+		"https://shop.testurl.com/{sku|a/b}",
+	}
+	for _, raw := range invalid {
+		_, err := shortener.ParseTemplate(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestTemplate_Fill(t *testing.T) {
+	t.Parallel()
+
+	const shop = "https://shop.testurl.com/{sku}?ref={ref|direct}"
+	const catalog = "https://shop.testurl.com/{1}/{2|all}"
+
+	tests := []struct {
+		name   string
+		tmpl   string
+		path   string
+		query  url.Values
+		exp    string
+		expErr bool
+	}{
+		{"query values", shop, "", url.Values{"sku": {"A-42"}, "ref": {"mail"}}, "https://shop.testurl.com/A-42?ref=mail", false},
+		{"default value", shop, "", url.Values{"sku": {"A-42"}}, "https://shop.testurl.com/A-42?ref=direct", false},
+		{"missing value", shop, "", nil, "", true},
+		{"disallowed characters", shop, "", url.Values{"sku": {"x/../admin"}}, "", true},
+		{"host injection", shop, "", url.Values{"sku": {"@evil.example"}}, "", true},
+		{"path segments", catalog, "/shoes/red", nil, "https://shop.testurl.com/shoes/red", false},
+		{"default segment", catalog, "/shoes", nil, "https://shop.testurl.com/shoes/all", false},
+		{"dot segment", catalog, "/..", nil, "", true},
+		{"too many segments", catalog, "/a/b/c", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpl, err := shortener.ParseTemplate(tt.tmpl)
+			require.NoError(t, err)
+
+			got, err := tmpl.Fill(tt.path, tt.query)
+			if tt.expErr {
+				assert.True(t, errors.Is(err, shortener.TemplateErr), err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, got)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// UTM are the campaign parameters added to the query of the destinations.
+// The links take the parameters they do not set from their domain.
+type UTM struct {
+	Source   string `db:"utm_source"`
+	Medium   string `db:"utm_medium"`
+	Campaign string `db:"utm_campaign"`
+}
+
+// Or returns the parameters with the empty ones taken from def.
+func (u UTM) Or(def UTM) UTM {
+	if u.Source == "" {
+		u.Source = def.Source
+	}
+	if u.Medium == "" {
+		u.Medium = def.Medium
+	}
+	if u.Campaign == "" {
+		u.Campaign = def.Campaign
+	}
+
+	return u
+}
+
+// Apply adds the parameters to the query of the destination URL. The
+// parameters the destination already has are kept as they are.
+func (u UTM) Apply(dest string) (string, error) {
+	if u == (UTM{}) {
+		return dest, nil
+	}
+
+	d, err := url.Parse(dest)
+	if err != nil {
+		return "", fmt.Errorf("parse destination: %w", err)
+	}
+
+	q := d.Query()
+	add := url.Values{}
+	for _, p := range []struct{ key, value string }{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+	} {
+		if _, ok := q[p.key]; !ok && p.value != "" {
+			add.Set(p.key, p.value)
+		}
+	}
+	if len(add) == 0 {
+		return dest, nil
+	}
+
+	// The parameters are appended to keep the destination's query as it is.
+	d.RawQuery = strings.TrimPrefix(d.RawQuery+"&"+add.Encode(), "&")
+
+	return d.String(), nil
+}
+
+// SetDomainUTM sets the UTM parameters of the domain's links.
+func (e Engine) SetDomainUTM(ctx context.Context, name string, u UTM) error {
+	const sql = `UPDATE domains SET utm_source = $2, utm_medium = $3, utm_campaign = $4 WHERE name = $1 RETURNING id`
+
+	var id int64
+	if err := e.DB.QueryRowxContext(ctx, sql, strings.ToLower(name), u.Source, u.Medium, u.Campaign).Scan(&id); err != nil {
+		return fmt.Errorf("query %s: %w", sql, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package shortener_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/illyasch/url-shortener/pkg/business/shortener"
+)
+
+func TestUTM_Apply(t *testing.T) {
+	t.Parallel()
+
+	domain := shortener.UTM{Source: "shortener", Medium: "link", Campaign: "always"}
+	link := shortener.UTM{Campaign: "summer"}
+
+	tests := []struct {
+		name string
+		utm  shortener.UTM
+		dest string
+		exp  string
+	}{
+		{"link over domain", link.Or(domain), "https://www.testurl.com/a",
+			"https://www.testurl.com/a?utm_campaign=summer&utm_medium=link&utm_source=shortener"},
+		{"destination parameters are kept", link.Or(domain), "https://www.testurl.com/a?b=1&utm_source=mail",
+			"https://www.testurl.com/a?b=1&utm_source=mail&utm_campaign=summer&utm_medium=link"},
+		{"no parameters", shortener.UTM{}, "https://www.testurl.com/a?b=1", "https://www.testurl.com/a?b=1"},
+		{"escaped values", shortener.UTM{Campaign: "a&b"}, "https://www.testurl.com/a#top",
+			"https://www.testurl.com/a?utm_campaign=a%26b#top"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.utm.Apply(tt.dest)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, got)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Package client is the Go client of the url-shortener HTTP API.
+//
+// The calls managing a link take the branded domain the link is looked up in; the
+// empty domain is the domain of the host of the base URL. The errors of the API
+// are *Error and match the problem code errors, e.g. NotFoundErr, with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The defaults of the retries of the failed requests.
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// maxResponseBytes limits the size of the responses read by the client.
+const maxResponseBytes = 16 << 20
+
+// Config is the configuration of the client.
+type Config struct {
+	// BaseURL is the absolute URL the service is served on with its path prefix, e.g. https://sho.rt/s.
+	// Its host selects the branded domain of the links which are shortened and opened.
+	BaseURL string
+
+	// APIKey is sent as the bearer token of the requests. The service needs one of its
+	// keys to list the links, to change their rules and variants and to delete them. It
+	// is not sent when empty.
+	APIKey string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times the failed requests are sent again; DefaultMaxRetries
+	// when 0, a negative value turns the retries off. The idempotent requests, the reads of
+	// the links, their stats, rules, variants and QR codes and the PUT and DELETE requests,
+	// are retried after a network error, a 5xx or a 429 status. Shortening and expanding the
+	// links create links and count clicks and password attempts, which must not happen twice,
+	// so they are only retried when the server did not handle them: after a 429 or 503 status
+	// or when the connection could not be made.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the exponentially growing waits between the retries,
+	// DefaultMinBackoff and DefaultMaxBackoff when 0. The requests the server asks to wait
+	// for longer than MaxBackoff with Retry-After are not retried.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Client calls the API of the service. It is safe for concurrent use.
+type Client struct {
+	base   *url.URL
+	cfg    Config
+	client *http.Client
+}
+
+// New constructs a client of the service on the base URL of the config.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("base url %q must be an absolute URL", cfg.BaseURL)
+	}
+
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{base: base, cfg: cfg, client: client}, nil
+}
+
+// request is a request to the API. It is built again for every retry.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+
+	// counted marks the GET requests the server counts, e.g. the clicks of Expand.
+	counted bool
+}
+
+// idempotent reports whether sending the request again has the same effect as sending it once.
+func (req request) idempotent() bool {
+	switch req.method {
+	case http.MethodGet, http.MethodHead:
+		return !req.counted
+	case http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// jsonRequest builds the request with the JSON body of the value, the body is left empty for a nil value.
+func jsonRequest(method, path string, query url.Values, in any) (request, error) {
+	req := request{method: method, path: path, query: query, header: http.Header{}}
+	req.header.Set("Accept", "application/json")
+	if in == nil {
+		return req, nil
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return req, fmt.Errorf("json marshal: %w", err)
+	}
+	req.body = body
+	req.header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// call sends the request with the JSON body of in and decodes the JSON response into out.
+// The body is not sent for a nil in, the response is not decoded for a nil out.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	req, err := jsonRequest(method, path, query, in)
+	if err != nil {
+		return err
+	}
+
+	return c.callRequest(ctx, req, out)
+}
+
+// callRequest sends the request and decodes the JSON response into out unless it is nil.
+func (c *Client) callRequest(ctx context.Context, req request, out any) error {
+	_, body, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s %s: json unmarshal: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends the request and returns its successful response with the body read. The requests
+// which may succeed later are retried with the backoff until the retries or the context end,
+// the requests which are not idempotent only when the server did not handle them.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.sendOnce(ctx, req)
+		if err == nil {
+			return resp, body, nil
+		}
+		if ctx.Err() != nil || attempt >= c.cfg.MaxRetries {
+			return nil, nil, err
+		}
+
+		wait := c.backoff(attempt)
+		var apiErr *Error
+		switch {
+		case errors.As(err, &apiErr):
+			if !apiErr.retryable(req.idempotent()) || apiErr.RetryAfter > c.cfg.MaxBackoff {
+				return nil, nil, err
+			}
+			if apiErr.RetryAfter > wait {
+				wait = apiErr.RetryAfter
+			}
+		case !req.idempotent() && !notConnected(err):
+			return nil, nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, fmt.Errorf("%s %s: %w", req.method, req.path, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOnce sends the request. The responses with an error status are returned as *Error.
+func (c *Client) sendOnce(ctx context.Context, req request) (*http.Response, []byte, error) {
+	u := *c.base
+	u.Path += req.path
+	u.RawPath = ""
+	if req.query != nil {
+		u.RawQuery = req.query.Encode()
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new request: %w", err)
+	}
+	for name, values := range req.header {
+		r.Header[name] = values
+	}
+	if c.cfg.APIKey != "" {
+		r.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: %w", req.method, req.path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: read body: %w", req.method, req.path, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, nil, responseError(resp, data)
+	}
+	return resp, data, nil
+}
+
+// notConnected reports whether the request failed as the connection to the server could not
+// be made, so nothing of it was sent.
+func notConnected(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// responseError reads the problem of the error response.
+func responseError(resp *http.Response, body []byte) *Error {
+	e := Error{Status: resp.StatusCode}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		_ = json.Unmarshal(body, &e)
+		e.Status = resp.StatusCode
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+
+	return &e
+}
+
+// backoff returns the wait before the retry of the attempt, it is doubled with every attempt
+// up to the max backoff. The waits are jittered, so the clients do not retry all at once.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.cfg.MaxBackoff
+	if attempt < 32 {
+		if d := c.cfg.MinBackoff << attempt; d > 0 && d < wait {
+			wait = d
+		}
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,385 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/illyasch/url-shortener/cmd/url-shortener/handlers"
+	"github.com/illyasch/url-shortener/pkg/client"
+	"github.com/illyasch/url-shortener/pkg/data/database/dbtest"
+	"github.com/illyasch/url-shortener/pkg/sys/logger"
+)
+
+var (
+	postgresDB *sqlx.DB
+	stdLgr     *zap.SugaredLogger
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	stdLgr, err = logger.New("shortener")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	postgresDB, err = dbtest.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// apiKey is the API key the served router lets the changes of the links through with.
+const apiKey = "test-api-key"
+
+// serve serves the router wrapped by the optional middleware and returns a client of it.
+func serve(t *testing.T, cfg client.Config, wrap func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+
+	var h http.Handler = handlers.APIConfig{Log: stdLgr, DB: postgresDB, APIKeys: []string{apiKey}}.Router()
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	cfg.BaseURL = srv.URL
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = time.Millisecond
+	}
+	c, err := client.New(cfg)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	for _, base := range []string{"", "sho.rt", "/s", "http://"} {
+		_, err := client.New(client.Config{BaseURL: base})
+		assert.Error(t, err, base)
+	}
+
+	_, err := client.New(client.Config{BaseURL: "https://sho.rt/s/"})
+	assert.NoError(t, err)
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	c := serve(t, client.Config{APIKey: apiKey}, nil)
+	ctx := context.Background()
+
+	owner := uuid.NewString()
+	expURL := "https://www.testurl.com/client/" + uuid.NewString()
+	su, err := c.Shorten(ctx, client.NewLink{URL: expURL, Owner: owner, Tags: []string{"client"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, su.Code)
+	assert.Contains(t, su.ShortURL, "/"+su.Code)
+
+	exp, err := c.Expand(ctx, su.Code, client.Visit{})
+	require.NoError(t, err)
+	assert.Equal(t, expURL, exp.URL)
+
+	l, err := c.Link(ctx, "", su.Code)
+	require.NoError(t, err)
+	assert.Equal(t, expURL, l.URL)
+	assert.Equal(t, []string{"client"}, l.Tags)
+	assert.Equal(t, int64(1), l.Clicks)
+
+	page, err := c.Links(ctx, client.Filter{Owner: owner})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	assert.Equal(t, su.Code, page.Links[0].Code)
+	assert.Empty(t, page.NextCursor)
+
+	rules := []client.Rule{{Platform: "ios", URL: "https://apps.apple.com/"}}
+	err = serve(t, client.Config{}, nil).SetRules(ctx, "", su.Code, rules)
+	assert.ErrorIs(t, err, client.UnauthorizedErr)
+	require.NoError(t, c.SetRules(ctx, "", su.Code, rules))
+	got, err := c.Rules(ctx, "", su.Code)
+	require.NoError(t, err)
+	assert.Equal(t, rules, got)
+
+	split := client.Split{Variants: []client.Variant{{Name: "a", URL: "https://www.testurl.com/a", Weight: 1}}}
+	require.NoError(t, c.SetSplit(ctx, "", su.Code, split))
+	gotSplit, err := c.Split(ctx, "", su.Code)
+	require.NoError(t, err)
+	assert.Equal(t, split, gotSplit)
+
+	stats, err := c.Stats(ctx, "", su.Code)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Clicks)
+
+	png, err := c.QRCode(ctx, su.Code, client.QROptions{Size: 64})
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", http.DetectContentType(png))
+	_, err = c.QRCode(ctx, su.Code, client.QROptions{Size: 1})
+	assert.ErrorIs(t, err, client.InvalidRequestErr)
+
+	require.NoError(t, c.DeleteLink(ctx, "", su.Code))
+	_, err = c.Link(ctx, "", su.Code)
+	assert.ErrorIs(t, err, client.NotFoundErr)
+	err = c.DeleteLink(ctx, "", su.Code)
+	assert.ErrorIs(t, err, client.NotFoundErr)
+
+	t.Run("batch", func(t *testing.T) {
+		expURL := "https://www.testurl.com/client/" + uuid.NewString()
+		results, err := c.ShortenBatch(ctx, []client.NewLink{{URL: expURL}, {URL: "hjef"}})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+
+		require.NoError(t, results[0].Err)
+		exp, err := c.Expand(ctx, results[0].Code, client.Visit{})
+		require.NoError(t, err)
+		assert.Equal(t, expURL, exp.URL)
+
+		assert.ErrorIs(t, results[1].Err, client.InvalidRequestErr)
+	})
+
+	t.Run("password", func(t *testing.T) {
+		su, err := c.Shorten(ctx, client.NewLink{
+			URL:      "https://www.testurl.com/client/" + uuid.NewString(),
+			Password: "secret",
+		})
+		require.NoError(t, err)
+
+		_, err = c.Expand(ctx, su.Code, client.Visit{})
+		assert.ErrorIs(t, err, client.PasswordRequiredErr)
+		_, err = c.Expand(ctx, su.Code, client.Visit{Password: "wrong"})
+		assert.ErrorIs(t, err, client.PasswordErr)
+		_, err = c.Expand(ctx, su.Code, client.Visit{Password: "secret"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		su, err := c.Shorten(ctx, client.NewLink{URL: "https://www.testurl.com/client", Passthrough: true})
+		require.NoError(t, err)
+
+		exp, err := c.Expand(ctx, su.Code, client.Visit{Path: "docs/intro"})
+		require.NoError(t, err)
+		assert.Equal(t, "https://www.testurl.com/client/docs/intro", exp.URL)
+	})
+}
+
+func TestClient_errors(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	c := serve(t, client.Config{APIKey: "key"}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	_, err := c.Shorten(context.Background(), client.NewLink{URL: "hjef"})
+	require.ErrorIs(t, err, client.InvalidRequestErr)
+	assert.NotErrorIs(t, err, client.NotFoundErr)
+
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.NotEmpty(t, apiErr.Detail)
+	assert.NotEmpty(t, apiErr.RequestID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the client errors are not retried")
+}
+
+func TestClient_retries(t *testing.T) {
+	t.Parallel()
+
+	// failing fails the first n requests with the status.
+	failing := func(calls *int32, n int32, status int, retryAfter string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(calls, 1) <= n {
+					if retryAfter != "" {
+						w.Header().Set("Retry-After", retryAfter)
+					}
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	t.Run("recovered", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{}, failing(&calls, 2, http.StatusServiceUnavailable, ""))
+
+		// The request reaches the handlers after the failures, the validation problem is not retried.
+		_, err := c.Shorten(context.Background(), client.NewLink{URL: "hjef"})
+		assert.ErrorIs(t, err, client.InvalidRequestErr)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{}, failing(&calls, 1, http.StatusTooManyRequests, "0"))
+
+		_, err := c.Shorten(context.Background(), client.NewLink{URL: "hjef"})
+		assert.ErrorIs(t, err, client.InvalidRequestErr)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{MaxRetries: 2}, failing(&calls, 100, http.StatusBadGateway, ""))
+
+		_, err := c.Link(context.Background(), "", "udXWFB")
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusBadGateway, apiErr.Status)
+		assert.Empty(t, apiErr.Code)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{MaxRetries: -1}, failing(&calls, 100, http.StatusInternalServerError, ""))
+
+		_, err := c.Shorten(context.Background(), client.NewLink{URL: "hjef"})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		t.Parallel()
+
+		// The shortened and expanded links may have been handled by the server failing with 502.
+		var calls int32
+		c := serve(t, client.Config{MaxRetries: 2}, failing(&calls, 100, http.StatusBadGateway, ""))
+		_, err := c.Shorten(context.Background(), client.NewLink{URL: "https://www.testurl.com"})
+		assert.Error(t, err)
+		_, err = c.Expand(context.Background(), "udXWFB", client.Visit{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+		// They were not handled by the server failing with 503.
+		atomic.StoreInt32(&calls, 0)
+		c = serve(t, client.Config{MaxRetries: 2}, failing(&calls, 100, http.StatusServiceUnavailable, ""))
+		_, err = c.Expand(context.Background(), "udXWFB", client.Visit{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("network errors", func(t *testing.T) {
+		t.Parallel()
+
+		// failing returns a client the transport of which fails every request with the operation.
+		failing := func(calls *int32, op string) *client.Client {
+			c, err := client.New(client.Config{
+				BaseURL:    "https://sho.rt",
+				MaxRetries: 2,
+				MinBackoff: time.Millisecond,
+				HTTPClient: &http.Client{Transport: roundTripper(func(*http.Request) (*http.Response, error) {
+					atomic.AddInt32(calls, 1)
+					return nil, &net.OpError{Op: op, Net: "tcp", Err: errors.New("failed")}
+				})},
+			})
+			require.NoError(t, err)
+			return c
+		}
+
+		var calls int32
+		_, err := failing(&calls, "dial").Shorten(context.Background(), client.NewLink{URL: "https://www.testurl.com"})
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "nothing was sent")
+
+		atomic.StoreInt32(&calls, 0)
+		_, err = failing(&calls, "read").Shorten(context.Background(), client.NewLink{URL: "https://www.testurl.com"})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "the request may have been handled")
+
+		atomic.StoreInt32(&calls, 0)
+		_, err = failing(&calls, "read").Link(context.Background(), "", "udXWFB")
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "the reads are idempotent")
+	})
+
+	t.Run("retry after too long", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{}, failing(&calls, 100, http.StatusTooManyRequests, "900"))
+
+		_, err := c.Shorten(context.Background(), client.NewLink{URL: "hjef"})
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, 900*time.Second, apiErr.RetryAfter)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
+
+// roundTripper is the http.RoundTripper of a function.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClient_cancel(t *testing.T) {
+	t.Parallel()
+
+	t.Run("request", func(t *testing.T) {
+		t.Parallel()
+
+		c := serve(t, client.Config{}, func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The server notices the client going away once the body is read.
+				_, _ = io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			})
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.Shorten(ctx, client.NewLink{URL: "hjef"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+		c := serve(t, client.Config{MinBackoff: time.Minute, MaxBackoff: time.Minute}, func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.Shorten(ctx, client.NewLink{URL: "hjef"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The errors of the problem codes of the API, see docs/problems.md. The errors
+// returned by the client match them with errors.Is.
+var (
+	InvalidRequestErr    = &Error{Code: "invalid_request"}
+	InvalidCodeErr       = &Error{Code: "invalid_code"}
+	CodeOutOfRangeErr    = &Error{Code: "code_out_of_range"}
+	InvalidParametersErr = &Error{Code: "invalid_parameters"}
+	NotFoundErr          = &Error{Code: "not_found"}
+	DomainNotFoundErr    = &Error{Code: "domain_not_found"}
+	PathNotAllowedErr    = &Error{Code: "path_not_allowed"}
+	NotStartedErr        = &Error{Code: "link_not_started"}
+	ExpiredErr           = &Error{Code: "link_expired"}
+	DisabledErr          = &Error{Code: "link_disabled"}
+	ExhaustedErr         = &Error{Code: "link_exhausted"}
+	PasswordRequiredErr  = &Error{Code: "password_required"}
+	PasswordErr          = &Error{Code: "password_incorrect"}
+	RateLimitedErr       = &Error{Code: "rate_limited"}
+	ForbiddenErr         = &Error{Code: "destination_forbidden"}
+	SharedErr            = &Error{Code: "link_shared"}
+	UnauthorizedErr      = &Error{Code: "unauthorized"}
+	InternalErr          = &Error{Code: "internal_error"}
+)
+
+// Error is the RFC 7807 problem the API responded with. The responses which are not
+// problems, e.g. of a proxy in front of the API, have the status without the code.
+type Error struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"request_id"`
+
+	// RetryAfter is the time the server asked to wait before the request is sent again.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	msg := e.Code
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Status != 0 {
+		msg = fmt.Sprintf("%d %s", e.Status, msg)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+
+	return msg
+}
+
+// Is reports whether the target is the error of the same problem code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// retryable reports whether the request failed with the error may succeed when it is sent again.
+// The requests which are not idempotent are only sent again when the server did not handle them.
+func (e *Error) retryable(idempotent bool) bool {
+	if !idempotent {
+		return e.Status == http.StatusTooManyRequests || e.Status == http.StatusServiceUnavailable
+	}
+
+	return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+}
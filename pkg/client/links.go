@@ -0,0 +1,302 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewLink is the link to shorten. Only the URL is required, see the shorten operation of
+// the OpenAPI document of the service for the meaning of the other fields.
+type NewLink struct {
+	URL           string     `json:"url"`
+	Owner         string     `json:"owner,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	Domain        string     `json:"domain,omitempty"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	SoonURL       string     `json:"soon_url,omitempty"`
+	EndedURL      string     `json:"ended_url,omitempty"`
+	Password      string     `json:"password,omitempty"`
+	MaxClicks     int64      `json:"max_clicks,omitempty"`
+	Passthrough   bool       `json:"passthrough,omitempty"`
+	QueryConflict string     `json:"query_conflict,omitempty"`
+	UTMSource     string     `json:"utm_source,omitempty"`
+	UTMMedium     string     `json:"utm_medium,omitempty"`
+	UTMCampaign   string     `json:"utm_campaign,omitempty"`
+	UTMDisabled   bool       `json:"utm_disabled,omitempty"`
+	Warn          string     `json:"warn,omitempty"`
+}
+
+// ShortURL is the code and the full short URL of a link.
+type ShortURL struct {
+	Code     string `json:"code"`
+	ShortURL string `json:"short_url"`
+}
+
+// BatchResult is the short URL of a link of the batch or the error it could not be shortened with.
+type BatchResult struct {
+	ShortURL
+	Err error
+}
+
+// MaxBatch is the most links ShortenBatch shortens in one request.
+const MaxBatch = 100
+
+// Visit is what the visitor opening a link sends with the code.
+type Visit struct {
+	// Password opens the protected links.
+	Password string
+
+	// Path is passed through to the destination of the links allowing it, e.g. docs/intro.
+	Path string
+}
+
+// Expansion is the destination of an opened link.
+type Expansion struct {
+	URL      string `json:"url"`
+	ShortURL string `json:"short_url"`
+	Variant  string `json:"variant,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// Link is a shortened link. The URL, SoonURL and EndedURL of the links protected by a password are empty.
+type Link struct {
+	Code          string     `json:"code"`
+	Domain        string     `json:"domain"`
+	ShortURL      string     `json:"short_url"`
+	URL           string     `json:"url"`
+	Owner         string     `json:"owner,omitempty"`
+	Tags          []string   `json:"tags"`
+	Clicks        int64      `json:"clicks"`
+	ClicksLeft    *int64     `json:"clicks_left,omitempty"`
+	Protected     bool       `json:"protected"`
+	Passthrough   bool       `json:"passthrough"`
+	QueryConflict string     `json:"query_conflict,omitempty"`
+	UTMSource     string     `json:"utm_source,omitempty"`
+	UTMMedium     string     `json:"utm_medium,omitempty"`
+	UTMCampaign   string     `json:"utm_campaign,omitempty"`
+	UTMDisabled   bool       `json:"utm_disabled"`
+	Warn          string     `json:"warn,omitempty"`
+	Flagged       bool       `json:"flagged"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	SoonURL       string     `json:"soon_url,omitempty"`
+	EndedURL      string     `json:"ended_url,omitempty"`
+	DateCreated   time.Time  `json:"date_created"`
+}
+
+// Filter selects the links of a list. The zero fields do not filter.
+type Filter struct {
+	Owner string
+	Tag   string
+	Query string
+
+	// Domain is the branded domain of the links, Host is the domain of their destinations.
+	Domain string
+	Host   string
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// Order is asc or desc by id, desc by default.
+	Order string
+
+	// Limit is the number of the links on a page, up to 100.
+	Limit int
+
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+// LinkPage is a page of a list of links. The last page has no NextCursor.
+type LinkPage struct {
+	Links      []Link `json:"links"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Rule sends the visitors matching all of its conditions to its URL. The URLs of the rules
+// of the links protected by a password are empty.
+type Rule struct {
+	Platform string            `json:"platform,omitempty"`
+	Language string            `json:"language,omitempty"`
+	Country  string            `json:"country,omitempty"`
+	Query    map[string]string `json:"query,omitempty"`
+	URL      string            `json:"url"`
+}
+
+// Variant is a destination of a split link, its weight is the share of the visitors it is served to.
+// The URLs of the variants of the links protected by a password are empty.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Split is the weighted variants of a link.
+type Split struct {
+	Variants []Variant `json:"variants"`
+	Sticky   bool      `json:"sticky"`
+}
+
+// VariantClicks is the number of the clicks a variant was served.
+type VariantClicks struct {
+	Variant string `json:"variant"`
+	Clicks  int64  `json:"clicks"`
+}
+
+// Stats is the clicks of a link.
+type Stats struct {
+	Code     string          `json:"code"`
+	ShortURL string          `json:"short_url"`
+	Clicks   int64           `json:"clicks"`
+	Variants []VariantClicks `json:"variants"`
+}
+
+// Shorten saves the link and returns its short URL.
+func (c *Client) Shorten(ctx context.Context, nl NewLink) (ShortURL, error) {
+	var su ShortURL
+	err := c.call(ctx, http.MethodPost, "/api/v1/shorten", nil, nl, &su)
+	return su, err
+}
+
+// ShortenBatch shortens up to MaxBatch links in one request. The results are in the order of
+// the links, the links which could not be shortened have the error of their problem.
+func (c *Client) ShortenBatch(ctx context.Context, links []NewLink) ([]BatchResult, error) {
+	var resp struct {
+		Results []struct {
+			ShortURL
+			Error *Error `json:"error"`
+		} `json:"results"`
+	}
+	body := struct {
+		Links []NewLink `json:"links"`
+	}{Links: links}
+	if err := c.call(ctx, http.MethodPost, "/api/v1/shorten/batch", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(resp.Results))
+	for i, r := range resp.Results {
+		results[i].ShortURL = r.ShortURL
+		if r.Error != nil {
+			results[i].Err = r.Error
+		}
+	}
+	return results, nil
+}
+
+// Expand opens the link with the code and returns its destination. Every expansion counts a click.
+func (c *Client) Expand(ctx context.Context, code string, v Visit) (Expansion, error) {
+	path := "/" + code
+	if v.Path != "" {
+		path += "/" + strings.TrimPrefix(v.Path, "/")
+	}
+
+	req, err := jsonRequest(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return Expansion{}, err
+	}
+	if v.Password != "" {
+		req.header.Set("X-Link-Password", v.Password)
+	}
+	req.counted = true
+
+	var exp Expansion
+	err = c.callRequest(ctx, req, &exp)
+	return exp, err
+}
+
+// Link returns the link without counting a click.
+func (c *Client) Link(ctx context.Context, domain, code string) (Link, error) {
+	var l Link
+	err := c.call(ctx, http.MethodGet, "/api/v1/links/"+code, domainQuery(domain), nil, &l)
+	return l, err
+}
+
+// Links returns a page of the links matching the filter.
+func (c *Client) Links(ctx context.Context, f Filter) (LinkPage, error) {
+	q := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	set("owner", f.Owner)
+	set("tag", f.Tag)
+	set("branded_domain", f.Domain)
+	set("domain", f.Host)
+	set("q", f.Query)
+	set("order", f.Order)
+	set("cursor", f.Cursor)
+	if !f.CreatedAfter.IsZero() {
+		q.Set("created_after", f.CreatedAfter.Format(time.RFC3339))
+	}
+	if !f.CreatedBefore.IsZero() {
+		q.Set("created_before", f.CreatedBefore.Format(time.RFC3339))
+	}
+	if f.Limit != 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	var page LinkPage
+	err := c.call(ctx, http.MethodGet, "/api/v1/links", q, nil, &page)
+	return page, err
+}
+
+// DeleteLink removes the link with its clicks.
+func (c *Client) DeleteLink(ctx context.Context, domain, code string) error {
+	return c.call(ctx, http.MethodDelete, "/api/v1/links/"+code, domainQuery(domain), nil, nil)
+}
+
+// Rules returns the ordered redirect rules of the link.
+func (c *Client) Rules(ctx context.Context, domain, code string) ([]Rule, error) {
+	var body struct {
+		Rules []Rule `json:"rules"`
+	}
+	err := c.call(ctx, http.MethodGet, "/api/v1/links/"+code+"/rules", domainQuery(domain), nil, &body)
+	return body.Rules, err
+}
+
+// SetRules replaces the redirect rules of the link, no rules remove them.
+func (c *Client) SetRules(ctx context.Context, domain, code string, rules []Rule) error {
+	if rules == nil {
+		rules = []Rule{}
+	}
+	body := struct {
+		Rules []Rule `json:"rules"`
+	}{Rules: rules}
+
+	return c.call(ctx, http.MethodPut, "/api/v1/links/"+code+"/rules", domainQuery(domain), body, nil)
+}
+
+// Split returns the weighted variants of the link.
+func (c *Client) Split(ctx context.Context, domain, code string) (Split, error) {
+	var s Split
+	err := c.call(ctx, http.MethodGet, "/api/v1/links/"+code+"/variants", domainQuery(domain), nil, &s)
+	return s, err
+}
+
+// SetSplit replaces the weighted variants of the link, no variants send the visitors to the link's URL again.
+func (c *Client) SetSplit(ctx context.Context, domain, code string, s Split) error {
+	return c.call(ctx, http.MethodPut, "/api/v1/links/"+code+"/variants", domainQuery(domain), s, nil)
+}
+
+// Stats returns the clicks of the link broken down by the variants served.
+func (c *Client) Stats(ctx context.Context, domain, code string) (Stats, error) {
+	var s Stats
+	err := c.call(ctx, http.MethodGet, "/api/v1/links/"+code+"/stats", domainQuery(domain), nil, &s)
+	return s, err
+}
+
+// domainQuery returns the query selecting the branded domain of a link.
+func domainQuery(domain string) url.Values {
+	if domain == "" {
+		return nil
+	}
+
+	return url.Values{"domain": {domain}}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// QROptions are the options of the image of a QR code. The zero fields are the defaults of the service.
+type QROptions struct {
+	// Format is png or svg.
+	Format string
+
+	// Size is the side of the image in pixels.
+	Size int
+
+	// ECC is the error correction level, L, M, Q or H.
+	ECC string
+
+	// Margin is the quiet zone in modules, nil is the default of 4.
+	Margin *int
+
+	// FG and BG are the colours in RRGGBB or RRGGBBAA hex notation.
+	FG string
+	BG string
+}
+
+// QRCode returns the image of the QR code of the full short URL of the link.
+func (c *Client) QRCode(ctx context.Context, code string, o QROptions) ([]byte, error) {
+	q := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	set("format", o.Format)
+	set("ecc", o.ECC)
+	set("fg", o.FG)
+	set("bg", o.BG)
+	if o.Size != 0 {
+		q.Set("size", strconv.Itoa(o.Size))
+	}
+	if o.Margin != nil {
+		q.Set("margin", strconv.Itoa(*o.Margin))
+	}
+
+	_, body, err := c.send(ctx, request{method: http.MethodGet, path: "/" + code + "/qr", query: q})
+	return body, err
+}
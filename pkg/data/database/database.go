@@ -7,8 +7,10 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // Calls init function.
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 )
 
 // Config is the required properties to use the database.
@@ -23,6 +25,7 @@ type Config struct {
 }
 
 // Open knows how to open a database connection based on the configuration.
+// Every SQL statement is traced with a span of the global tracer provider.
 func Open(cfg Config) (*sqlx.DB, error) {
 	sslMode := "require"
 	if cfg.DisableTLS {
@@ -41,10 +44,18 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		RawQuery: q.Encode(),
 	}
 
-	db, err := sqlx.Open("postgres", u.String())
+	sqlDB, err := otelsql.Open("postgres", u.String(),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
+
+	db := sqlx.NewDb(sqlDB, "postgres")
 	db.SetMaxIdleConns(cfg.MaxIdleConns)
 	db.SetMaxOpenConns(cfg.MaxOpenConns)
 
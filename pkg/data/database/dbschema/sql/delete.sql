@@ -1 +1,2 @@
 DELETE FROM urls;
+DELETE FROM domains WHERE name <> 'default';
@@ -4,4 +4,104 @@ CREATE TABLE urls (
     id SERIAL PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     date_created  TIMESTAMP
-);
\ No newline at end of file
+);
+-- Version: 1.2
+-- Description: Add owner, host and tags to urls for listing and search
+UPDATE urls SET date_created = NOW() WHERE date_created IS NULL;
+ALTER TABLE urls
+    ALTER COLUMN date_created SET NOT NULL,
+    ALTER COLUMN date_created SET DEFAULT NOW(),
+    ADD COLUMN owner TEXT NOT NULL DEFAULT '',
+    ADD COLUMN host  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tags  TEXT[] NOT NULL DEFAULT '{}';
+UPDATE urls SET host = lower(coalesce(substring(url FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)'), ''));
+CREATE INDEX urls_owner_idx ON urls (owner, id);
+CREATE INDEX urls_host_idx ON urls (host, id);
+CREATE INDEX urls_date_created_idx ON urls (date_created);
+CREATE INDEX urls_tags_idx ON urls USING GIN (tags);
+-- Version: 1.3
+-- Description: Create table domains and namespace the codes per domain
+CREATE TABLE domains (
+    id              SERIAL PRIMARY KEY,
+    name            TEXT NOT NULL UNIQUE,
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    fallback_url    TEXT NOT NULL DEFAULT '',
+    last_code       BIGINT NOT NULL DEFAULT 0,
+    date_created    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+INSERT INTO domains (name, last_code) SELECT 'default', COALESCE(MAX(id), 0) FROM urls;
+ALTER TABLE urls
+    ADD COLUMN domain_id INT REFERENCES domains (id),
+    ADD COLUMN code_id BIGINT;
+UPDATE urls SET domain_id = (SELECT id FROM domains WHERE name = 'default'), code_id = id;
+ALTER TABLE urls
+    ALTER COLUMN domain_id SET NOT NULL,
+    ALTER COLUMN code_id SET NOT NULL,
+    DROP CONSTRAINT urls_url_key,
+    ADD CONSTRAINT urls_domain_id_code_id_key UNIQUE (domain_id, code_id),
+    ADD CONSTRAINT urls_domain_id_url_key UNIQUE (domain_id, url);
+-- Version: 1.4
+-- Description: Add expiration and disabling of urls, share only plain urls
+ALTER TABLE urls
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN shared BOOLEAN NOT NULL DEFAULT true,
+    DROP CONSTRAINT urls_domain_id_url_key;
+CREATE UNIQUE INDEX urls_domain_id_url_shared_idx ON urls (domain_id, url) WHERE shared;
+-- Version: 1.5
+-- Description: Count the clicks of urls
+ALTER TABLE urls ADD COLUMN clicks BIGINT NOT NULL DEFAULT 0;
+-- Version: 1.6
+-- Description: Protect urls with passwords
+ALTER TABLE urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+-- Version: 1.7
+-- Description: Limit the clicks of urls
+ALTER TABLE urls ADD COLUMN clicks_left BIGINT NULL;
+-- Version: 1.8
+-- Description: Schedule the activation windows of urls
+ALTER TABLE urls RENAME COLUMN expires_at TO not_after;
+ALTER TABLE urls
+    ADD COLUMN not_before TIMESTAMP,
+    ADD COLUMN soon_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ended_url TEXT NOT NULL DEFAULT '';
+-- Version: 1.9
+-- Description: Add redirect rules to urls
+ALTER TABLE urls ADD COLUMN rules JSONB NOT NULL DEFAULT '[]';
+-- Version: 1.10
+-- Description: Split urls into weighted variants and record their clicks
+ALTER TABLE urls ADD COLUMN split JSONB NOT NULL DEFAULT '{}';
+CREATE TABLE clicks (
+    id           BIGSERIAL PRIMARY KEY,
+    url_id       INT NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    variant      TEXT NOT NULL DEFAULT '',
+    date_created TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX clicks_url_id_variant_idx ON clicks (url_id, variant);
+-- Version: 1.11
+-- Description: Pass paths and queries of urls through to the destinations
+ALTER TABLE urls
+    ADD COLUMN passthrough    BOOL NOT NULL DEFAULT false,
+    ADD COLUMN query_conflict TEXT NOT NULL DEFAULT 'keep';
+-- Version: 1.12
+-- Description: Tag the destinations of urls with UTM parameters
+ALTER TABLE domains
+    ADD COLUMN utm_source   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN utm_medium   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls
+    ADD COLUMN utm_source   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN utm_medium   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT '',
+    ADD COLUMN utm_disabled BOOL NOT NULL DEFAULT false;
+-- Version: 1.13
+-- Description: Warn visitors of external or flagged urls on an interstitial page
+ALTER TABLE domains
+    ADD COLUMN interstitial       BOOL NOT NULL DEFAULT false,
+    ADD COLUMN interstitial_delay INT NOT NULL DEFAULT 0,
+    ADD COLUMN trusted_domains    TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE urls
+    ADD COLUMN warn    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN flagged BOOL NOT NULL DEFAULT false;
+-- Version: 1.14
+-- Description: Stop sharing the urls with an owner or tags
+UPDATE urls SET shared = false WHERE owner <> '' OR cardinality(tags) > 0;
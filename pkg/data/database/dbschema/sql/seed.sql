@@ -1,3 +1,6 @@
-INSERT INTO urls (url, date_created) VALUES
-	('https://www.cnn.com', '2019-03-24 00:00:00')
-	ON CONFLICT DO NOTHING;
\ No newline at end of file
+WITH d AS (
+	UPDATE domains SET last_code = last_code + 1 WHERE name = 'default' RETURNING id, last_code
+)
+INSERT INTO urls (domain_id, code_id, url, host, date_created)
+	SELECT id, last_code, 'https://www.cnn.com', 'www.cnn.com', '2019-03-24 00:00:00' FROM d
+	ON CONFLICT DO NOTHING;
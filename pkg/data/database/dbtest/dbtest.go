@@ -0,0 +1,55 @@
+// Package dbtest provides support for the tests using the database.
+package dbtest
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ardanlabs/conf/v3"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/illyasch/url-shortener/pkg/data/database"
+)
+
+// Open connects to the test database configured with the SHORTENER_DB_*
+// environment variables, e.g. SHORTENER_DB_HOST.
+func Open() (*sqlx.DB, error) {
+	cfg := struct {
+		conf.Version
+		DB struct {
+			User         string `conf:"default:postgres"`
+			Password     string `conf:"default:nimda,mask"`
+			Host         string `conf:"default:localhost"`
+			Name         string `conf:"default:postgres"`
+			MaxIdleConns int    `conf:"default:0"`
+			MaxOpenConns int    `conf:"default:0"`
+			DisableTLS   bool   `conf:"default:true"`
+		}
+	}{
+		Version: conf.Version{
+			Build: "test",
+			Desc:  "Copyright Ilya Scheblanov",
+		},
+	}
+
+	const prefix = "SHORTENER"
+	if _, err := conf.Parse(prefix, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	log.Println(cfg)
+
+	db, err := database.Open(database.Config{
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name,
+		MaxIdleConns: cfg.DB.MaxIdleConns,
+		MaxOpenConns: cfg.DB.MaxOpenConns,
+		DisableTLS:   cfg.DB.DisableTLS,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect database: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,49 @@
+// Package geoip finds the countries of IP addresses in a local MaxMind
+// database file, e.g. GeoLite2-Country.mmdb.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB is an open GeoIP database. A nil DB finds no countries.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// Open opens the MaxMind database file.
+func Open(path string) (*DB, error) {
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	return &DB{reader: r}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the IP address's country or
+// an empty string when the country is unknown.
+func (db *DB) Country(ip net.IP) string {
+	if db == nil || ip == nil {
+		return ""
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+
+	return record.Country.ISOCode
+}
+
+// Close closes the database file.
+func (db *DB) Close() error {
+	return db.reader.Close()
+}
@@ -0,0 +1,86 @@
+// Package metrics collects the metrics of the service and exposes them in
+// the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Metrics is the registry of the service's metrics. A nil Metrics collects nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	links    *prometheus.CounterVec
+}
+
+// New constructs the metrics of the requests, the link operations, the Go
+// runtime, the process and the pool of the database.
+func New(db *sql.DB) *Metrics {
+	m := Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of the HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		links: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "link_operations_total",
+			Help:      "Number of the shortened and expanded links by outcome.",
+		}, []string{"operation", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.latency,
+		m.links,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+	}
+
+	return &m
+}
+
+// Handler returns the handler serving the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest counts the request served by the route and records its latency.
+func (m *Metrics) ObserveRequest(route string, method string, statusCode int, latency time.Duration) {
+	if m == nil {
+		return
+	}
+
+	status := strconv.Itoa(statusCode)
+	m.requests.WithLabelValues(route, method, status).Inc()
+	m.latency.WithLabelValues(route, method, status).Observe(latency.Seconds())
+}
+
+// CountLink counts the outcome of shortening or expanding a link.
+func (m *Metrics) CountLink(operation string, outcome string) {
+	if m == nil {
+		return
+	}
+
+	m.links.WithLabelValues(operation, outcome).Inc()
+}
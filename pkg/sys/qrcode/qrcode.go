@@ -0,0 +1,283 @@
+// Package qrcode renders QR codes of the short links as PNG and SVG images.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"rsc.io/qr/coding"
+)
+
+// Error correction levels, from the least to the most tolerant of damage.
+const (
+	L = coding.L
+	M = coding.M
+	Q = coding.Q
+	H = coding.H
+)
+
+// Options control how a QR code is rendered.
+type Options struct {
+	// Size is the side of the image in pixels. The PNG images are rounded
+	// down to a whole number of pixels per module.
+	Size int
+
+	// Margin is the width of the quiet zone around the code in modules.
+	Margin int
+
+	Level      coding.Level
+	Foreground color.NRGBA
+	Background color.NRGBA
+}
+
+// DefaultOptions are the options recommended by the QR code specification.
+var DefaultOptions = Options{
+	Size:       256,
+	Margin:     4,
+	Level:      M,
+	Foreground: color.NRGBA{A: 0xff},
+	Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+}
+
+// Encode encodes the text to a QR code of the smallest version fitting the
+// text at the level. Of the eight masks it applies the one giving the lowest
+// penalty score as the specification requires.
+func Encode(text string, level coding.Level) (*coding.Code, error) {
+	var enc coding.Encoding
+	switch {
+	case coding.Num(text).Check() == nil:
+		enc = coding.Num(text)
+	case coding.Alpha(text).Check() == nil:
+		enc = coding.Alpha(text)
+	default:
+		enc = coding.String(text)
+	}
+
+	v := coding.Version(coding.MinVersion)
+	for ; enc.Bits(v) > v.DataBytes(level)*8; v++ {
+		if v == coding.MaxVersion {
+			return nil, errors.New("text is too long to encode as QR code")
+		}
+	}
+
+	var best *coding.Code
+	bestPenalty := 0
+	for mask := coding.Mask(0); mask < 8; mask++ {
+		p, err := coding.NewPlan(v, level, mask)
+		if err != nil {
+			return nil, fmt.Errorf("plan mask %d: %w", mask, err)
+		}
+
+		code, err := p.Encode(enc)
+		if err != nil {
+			return nil, fmt.Errorf("encode mask %d: %w", mask, err)
+		}
+
+		if score := penalty(code); best == nil || score < bestPenalty {
+			best, bestPenalty = code, score
+		}
+	}
+
+	return best, nil
+}
+
+// penalty scores the undesirable patterns of the code by the rules N1-N4 of
+// ISO/IEC 18004.
+func penalty(c *coding.Code) int {
+	n := c.Size
+	score := 0
+
+	// N1: five and more modules of the same colour in a row or a column.
+	// N3: patterns looking like a finder pattern.
+	finder := []bool{true, false, true, true, true, false, true}
+	for i := 0; i < n; i++ {
+		for _, at := range []func(j int) bool{
+			func(j int) bool { return c.Black(j, i) },
+			func(j int) bool { return c.Black(i, j) },
+		} {
+			run := 1
+			for j := 1; j <= n; j++ {
+				if j < n && at(j) == at(j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for j := 0; j+len(finder) <= n; j++ {
+				match := true
+				for k, black := range finder {
+					if at(j+k) != black {
+						match = false
+						break
+					}
+				}
+				if match && (light(at, j-4, j) || light(at, j+len(finder), j+len(finder)+4)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// N2: 2x2 blocks of the same colour.
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.Black(x, y) {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				b := c.Black(x, y)
+				if c.Black(x+1, y) == b && c.Black(x, y+1) == b && c.Black(x+1, y+1) == b {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// N4: the deviation of the dark modules' share from 50%.
+	percent := dark * 100 / (n * n)
+	deviation := percent - 50
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	score += deviation / 5 * 10
+
+	return score
+}
+
+// light reports whether the modules from..to (exclusive) are all light.
+// The modules outside of the code are light.
+func light(at func(j int) bool, from int, to int) bool {
+	for j := from; j < to; j++ {
+		if j >= 0 && at(j) {
+			return false
+		}
+	}
+	return true
+}
+
+// PNG encodes the text to a QR code and renders it as a PNG image.
+func PNG(text string, o Options) ([]byte, error) {
+	code, err := Encode(text, o.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := code.Size + 2*o.Margin
+	scale := o.Size / modules
+	if scale < 1 {
+		scale = 1
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), color.Palette{o.Background, o.Foreground})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+o.Margin)*scale+dx, (y+o.Margin)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("png encode: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SVG encodes the text to a QR code and renders it as an SVG image. The dark
+// modules of a row are merged into horizontal runs to keep the image small.
+func SVG(text string, o Options) ([]byte, error) {
+	code, err := Encode(text, o.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := code.Size + 2*o.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		o.Size, o.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"%s/>`, hex(o.Background), opacity(o.Background))
+	fmt.Fprintf(&buf, `<path fill="%s"%s d="`, hex(o.Foreground), opacity(o.Foreground))
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Black(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+o.Margin, y+o.Margin, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes(), nil
+}
+
+// ParseLevel parses the error correction level letter L, M, Q or H.
+func ParseLevel(s string) (coding.Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return L, nil
+	case "M":
+		return M, nil
+	case "Q":
+		return Q, nil
+	case "H":
+		return H, nil
+	}
+
+	return 0, fmt.Errorf("unknown error correction level %q", s)
+}
+
+// ParseColor parses a colour in the hexadecimal RRGGBB or RRGGBBAA notation
+// with an optional leading #.
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("colour %q is not RRGGBB or RRGGBBAA", s)
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	var c color.NRGBA
+	if _, err := fmt.Sscanf(s, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil {
+		return color.NRGBA{}, fmt.Errorf("colour %q is not hexadecimal: %w", s, err)
+	}
+
+	return c, nil
+}
+
+// hex formats the colour as #RRGGBB.
+func hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// opacity formats the fill-opacity attribute of a translucent colour.
+func opacity(c color.NRGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+}
@@ -0,0 +1,86 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	gozxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/illyasch/url-shortener/pkg/sys/qrcode"
+)
+
+func TestPNG(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		text  string
+		level string
+	}{
+		{"short URL at level L", "https://go.example/udXWFB", "L"},
+		{"short URL at level M", "http://localhost:3000/udXWFB", "M"},
+		{"long URL at level H", "https://www.testurl.com/foo/bar/" + strings.Repeat("baz/", 30), "H"},
+		{"alphanumeric text at level Q", "HTTPS://SHO.RT/ABC", "Q"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := qrcode.DefaultOptions
+			var err error
+			opts.Level, err = qrcode.ParseLevel(tt.level)
+			require.NoError(t, err)
+
+			b, err := qrcode.PNG(tt.text, opts)
+			require.NoError(t, err)
+
+			img, err := png.Decode(bytes.NewReader(b))
+			require.NoError(t, err)
+			assert.LessOrEqual(t, img.Bounds().Dx(), opts.Size)
+
+			bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+			require.NoError(t, err)
+			got, err := gozxingqr.NewQRCodeReader().Decode(bmp, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.text, got.GetText())
+		})
+	}
+}
+
+func TestSVG(t *testing.T) {
+	t.Parallel()
+
+	opts := qrcode.DefaultOptions
+	opts.Foreground = color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x80}
+
+	b, err := qrcode.SVG("https://go.example/udXWFB", opts)
+	require.NoError(t, err)
+
+	svg := string(b)
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `fill="#112233" fill-opacity="0.502"`)
+	assert.Contains(t, svg, `width="256" height="256"`)
+}
+
+func TestParseColor(t *testing.T) {
+	t.Parallel()
+
+	c, err := qrcode.ParseColor("#0b62d6")
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0x0b, G: 0x62, B: 0xd6, A: 0xff}, c)
+
+	c, err = qrcode.ParseColor("0b62d680")
+	require.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0x0b, G: 0x62, B: 0xd6, A: 0x80}, c)
+
+	_, err = qrcode.ParseColor("blue")
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Package tracing sets up the OpenTelemetry tracing of the service. The spans
+// are exported over OTLP/HTTP or written to stdout, and the W3C trace context
+// is propagated in the traceparent and tracestate headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The exporters of the spans.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config is the required properties to export the spans.
+type Config struct {
+	ServiceName string
+	Build       string
+
+	// Exporter is one of the Exporter constants.
+	Exporter string
+
+	// Endpoint is the host and port of the OTLP/HTTP collector, e.g. localhost:4318.
+	Endpoint string
+	Insecure bool
+
+	// Probability is the share of the traces started by the service which are sampled.
+	// The traces started by the callers keep their sampling decision.
+	Probability float64
+}
+
+// Start sets up the global tracer provider exporting the spans and the W3C
+// trace context propagator. The returned function flushes the spans and
+// stops the provider.
+func Start(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		var err error
+		if exporter, err = otlptracehttp.New(ctx, opts...); err != nil {
+			return nil, fmt.Errorf("create otlp exporter: %w", err)
+		}
+
+	case ExporterStdout:
+		var err error
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout)); err != nil {
+			return nil, fmt.Errorf("create stdout exporter: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("exporter must be %s, %s or %s", ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(cfg.Build),
+	)
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Probability))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// IDs returns the trace and span IDs of the span in the context, they are
+// empty when the context has no span.
+func IDs(ctx context.Context) (traceID string, spanID string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+
+	return sc.TraceID().String(), sc.SpanID().String()
+}